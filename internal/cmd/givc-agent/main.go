@@ -153,6 +153,16 @@ func main() {
 		},
 	}
 
+	// Create and resgister gRPC services
+	var grpcServices []types.GrpcServiceRegistration
+
+	// Create systemd control server
+	systemdControlServer, err := servicemanager.NewSystemdControlServer(cfgAgent.Services, applications)
+	if err != nil {
+		log.Fatalf("Cannot create systemd control server")
+	}
+	grpcServices = append(grpcServices, systemdControlServer)
+
 	// Register this instance
 	serverStarted := make(chan struct{})
 	go func() {
@@ -162,8 +172,16 @@ func main() {
 		// Register agent
 		serviceclient.RegisterRemoteService(cfgAdminServer, agentEntryRequest)
 
-		// Register services
-		for _, service := range services {
+		// Register services; optional entries are marked with a trailing '?' and skipped if missing
+		for _, entry := range services {
+			service, optional := strings.CutSuffix(entry, "?")
+			if optional {
+				_, err := systemdControlServer.Controller.FindUnit(service)
+				if err != nil {
+					log.Infof("Skipping optional service %s: %v", service, err)
+					continue
+				}
+			}
 			if strings.Contains(service, ".service") {
 				serviceEntryRequest := &admin.RegistryRequest{
 					Name:   service,
@@ -185,16 +203,6 @@ func main() {
 		}
 	}()
 
-	// Create and resgister gRPC services
-	var grpcServices []types.GrpcServiceRegistration
-
-	// Create systemd control server
-	systemdControlServer, err := servicemanager.NewSystemdControlServer(cfgAgent.Services, applications)
-	if err != nil {
-		log.Fatalf("Cannot create systemd control server")
-	}
-	grpcServices = append(grpcServices, systemdControlServer)
-
 	if wifiEnabled {
 		// Create wifi control server
 		wifiControlServer, err := wifimanager.NewWifiControlServer()
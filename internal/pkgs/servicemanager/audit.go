@@ -0,0 +1,71 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"context"
+	"time"
+)
+
+// AuditPhase tells whether an audited operation is about to run or has completed.
+type AuditPhase string
+
+const (
+	AuditStarted   AuditPhase = "started"
+	AuditCompleted AuditPhase = "completed"
+)
+
+// AuditEvent describes a mutating operation on a unit, e.g. to record it in an append-only log.
+type AuditEvent struct {
+	Time      time.Time
+	Phase     AuditPhase
+	Unit      string
+	Operation string
+	// Actor attached to the operation's context with WithActor; empty if none
+	Actor string
+	// Outcome of a completed operation; nil on success
+	Err error
+}
+
+// WithAuditHook sets a hook called before and after every mutating operation, also if it fails.
+// The hook is called synchronously and must be safe for concurrent use.
+func WithAuditHook(hook func(event AuditEvent)) ControllerOption {
+	return func(c *SystemdController) {
+		c.auditHook = hook
+	}
+}
+
+type actorKey struct{}
+
+// WithActor returns a context identifying the actor of the operations it is passed to, e.g. the
+// VM or agent issuing a request, for audit events.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor attached with WithActor, or an empty string.
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// beginOp audits the start of a mutating operation and returns the function completing it, which
+// is deferred with a pointer to the operation's named error result:
+//
+//	defer c.beginOp(ctx, name, "stop")(&err)
+func (c *SystemdController) beginOp(ctx context.Context, name string, op string) func(err *error) {
+	start := time.Now()
+	actor := ActorFromContext(ctx)
+	if c.auditHook != nil {
+		c.auditHook(AuditEvent{Time: start, Phase: AuditStarted, Unit: name, Operation: op, Actor: actor})
+	}
+	return func(err *error) {
+		c.metrics.ObserveOp(name, op, time.Since(start), *err)
+		if c.auditHook != nil {
+			c.auditHook(AuditEvent{Time: time.Now(), Phase: AuditCompleted, Unit: name, Operation: op, Actor: actor, Err: *err})
+		}
+	}
+}
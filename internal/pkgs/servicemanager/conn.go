@@ -0,0 +1,56 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"context"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// systemdConn is the subset of the go-systemd connection used by the controller, so a fake
+// manager can be injected with newControllerWithConn.
+type systemdConn interface {
+	Close()
+	Connected() bool
+
+	// Units
+	ListUnitsContext(ctx context.Context) ([]dbus.UnitStatus, error)
+	ListUnitsFilteredContext(ctx context.Context, states []string) ([]dbus.UnitStatus, error)
+	ListUnitsByNamesContext(ctx context.Context, units []string) ([]dbus.UnitStatus, error)
+	ListUnitsByPatternsContext(ctx context.Context, states []string, patterns []string) ([]dbus.UnitStatus, error)
+
+	// Jobs
+	ListJobsContext(ctx context.Context) ([]dbus.JobStatus, error)
+	StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	TryRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	StartTransientUnitContext(ctx context.Context, name string, mode string, properties []dbus.Property, ch chan<- string) (int, error)
+
+	// Unit control
+	KillUnitWithTarget(ctx context.Context, name string, target dbus.Who, signal int32) error
+	ResetFailedUnitContext(ctx context.Context, name string) error
+	FreezeUnit(ctx context.Context, unit string) error
+	ThawUnit(ctx context.Context, unit string) error
+	SetUnitPropertiesContext(ctx context.Context, name string, runtime bool, properties ...dbus.Property) error
+
+	// Unit files
+	ListUnitFilesByPatternsContext(ctx context.Context, states []string, patterns []string) ([]dbus.UnitFile, error)
+	EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error)
+	DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
+	MaskUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) ([]dbus.MaskUnitFileChange, error)
+	UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error)
+	ReloadContext(ctx context.Context) error
+
+	// Properties
+	GetManagerProperty(prop string) (string, error)
+	GetAllPropertiesContext(ctx context.Context, unit string) (map[string]interface{}, error)
+	GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]interface{}, error)
+	GetUnitPropertyContext(ctx context.Context, unit string, propertyName string) (*dbus.Property, error)
+	GetServicePropertyContext(ctx context.Context, service string, propertyName string) (*dbus.Property, error)
+	GetUnitTypePropertiesContext(ctx context.Context, unit string, unitType string) (map[string]interface{}, error)
+}
+
+var _ systemdConn = (*dbus.Conn)(nil)
@@ -0,0 +1,126 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	dbus_direct "github.com/godbus/dbus/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeConn is an in-memory systemd manager. Methods not overridden by the embedded systemdConn
+// panic, so tests notice when the controller uses more of the manager than expected.
+type fakeConn struct {
+	systemdConn
+
+	mu    sync.Mutex
+	units map[string]dbus.UnitStatus
+	jobID int
+
+	// startUnit replaces the default start job, which completes with 'done'
+	startUnit func(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+}
+
+func newFakeConn(units ...string) *fakeConn {
+	conn := &fakeConn{units: make(map[string]dbus.UnitStatus)}
+	for _, name := range units {
+		conn.units[name] = dbus.UnitStatus{Name: name, LoadState: "loaded", ActiveState: "inactive", SubState: "dead"}
+	}
+	return conn
+}
+
+func (f *fakeConn) Close() {}
+
+func (f *fakeConn) Connected() bool { return true }
+
+func (f *fakeConn) ListUnitsContext(ctx context.Context) ([]dbus.UnitStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var units []dbus.UnitStatus
+	for _, unit := range f.units {
+		units = append(units, unit)
+	}
+	slices.SortFunc(units, func(a, b dbus.UnitStatus) int { return strings.Compare(a.Name, b.Name) })
+	return units, nil
+}
+
+func (f *fakeConn) ListUnitsByNamesContext(ctx context.Context, names []string) ([]dbus.UnitStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var units []dbus.UnitStatus
+	for _, name := range names {
+		unit, ok := f.units[name]
+		if !ok {
+			unit = dbus.UnitStatus{Name: name, LoadState: "not-found", ActiveState: "inactive", SubState: "dead"}
+		}
+		units = append(units, unit)
+	}
+	return units, nil
+}
+
+func (f *fakeConn) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	if f.startUnit != nil {
+		return f.startUnit(ctx, name, mode, ch)
+	}
+	return f.runJob(name, "active", "running", ch), nil
+}
+
+func (f *fakeConn) StartTransientUnitContext(ctx context.Context, name string, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	return f.runJob(name, "active", "running", ch), nil
+}
+
+func (f *fakeConn) GetServicePropertyContext(ctx context.Context, service string, propertyName string) (*dbus.Property, error) {
+	switch propertyName {
+	case "MainPID":
+		return &dbus.Property{Name: propertyName, Value: dbus_direct.MakeVariant(uint32(0))}, nil
+	}
+	return nil, dbus_direct.Error{Name: "org.freedesktop.DBus.Error.UnknownProperty"}
+}
+
+// runJob moves the unit to the state and reports the job as done.
+func (f *fakeConn) runJob(name string, activeState string, subState string, ch chan<- string) int {
+	f.mu.Lock()
+	f.jobID++
+	jobID := f.jobID
+	f.units[name] = dbus.UnitStatus{Name: name, LoadState: "loaded", ActiveState: activeState, SubState: subState}
+	f.mu.Unlock()
+	if ch != nil {
+		ch <- "done"
+	}
+	return jobID
+}
+
+// newTestController returns a controller on the fake manager with quiet logging.
+func newTestController(t *testing.T, conn *fakeConn, whitelist []string, opts ...ControllerOption) *SystemdController {
+	t.Helper()
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	opts = append([]ControllerOption{WithLogger(logger)}, opts...)
+	c, err := newControllerWithConn(conn, false, whitelist, nil, opts...)
+	if err != nil {
+		t.Fatalf("cannot create controller: %v", err)
+	}
+	return c
+}
+
+// newTestBinPath returns a bin path containing empty executables with the given names.
+func newTestBinPath(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
@@ -4,394 +4,4055 @@ package servicemanager
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	util "givc/internal/pkgs/utility"
 
 	"github.com/coreos/go-systemd/v22/dbus"
+	dbus_direct "github.com/godbus/dbus/v5"
 	"github.com/shirou/gopsutil/process"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	DefaultBinPath        = "/run/current-system/sw/bin"
+	DefaultStartTimeout   = 10 * time.Second
+	DefaultCloseTimeout   = 15 * time.Second
+	FreezeTimeout         = 5 * time.Second
+	DefaultProbeTimeout   = 5 * time.Second
+	DefaultWatchInterval  = 1 * time.Second
+	unitStatePollInterval = 200 * time.Millisecond
+	unitSettleTime        = 1 * time.Second
+	cpuSampleInterval     = 100 * time.Millisecond
+)
+
+var (
+	ErrNotWhitelisted = errors.New("unit is not whitelisted")
+	ErrUnitNotFound   = errors.New("unit not found")
+	ErrUnitType       = errors.New("unit type not allowed")
+	ErrNotConnected   = errors.New("dbus connection is closed")
+	ErrAlreadyRunning = errors.New("application is already running")
+	ErrUnitNotRunning = errors.New("unit is not running")
+	ErrStopKilled     = errors.New("unit was killed after stop timeout")
+	// ErrPermissionDenied is returned when the manager refuses the operation, e.g. a user mode
+	// controller acting on a system unit
+	ErrPermissionDenied = errors.New("controller lacks privilege for unit")
+	// ErrRemoteManager is returned by methods reading the local host, e.g. its journal or /proc,
+	// when the controller manages a remote manager set with WithBusAddress
+	ErrRemoteManager = errors.New("not supported for a remote manager")
+)
+
+// applicationServiceRegex matches application instance names like 'chromium@1.service', or
+// 'chromium@.service' for a generated instance
+var applicationServiceRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+@[a-zA-Z0-9_.:-]*\.service$`)
+
+var stopJobModes = []string{"replace", "fail", "isolate", "ignore-dependencies", "ignore-requirements"}
+
 type SystemdController struct {
-	conn         *dbus.Conn
 	whitelist    []string
-	applications map[string]string
+	applications map[string]AppSpec
+	startTimeout time.Duration
+	systemMode   bool
+	allowedTypes []string
+	binPath      string
+	busAddress   string
+	dryRun       bool
+	retryPolicy  RetryPolicy
+
+	unwhitelistedReads bool
+
+	// optionErrs collects invalid option values, reported together with the configuration errors
+	optionErrs []error
+
+	logStreamSize int
+	logStreamDrop bool
+	watchInterval time.Duration
+	metrics       Metrics
+	auditHook     func(event AuditEvent)
+	logger        log.FieldLogger
+
+	// mu guards whitelist, its optional entries, and the application services added by
+	// StartApplication, which are shared across concurrent gRPC handlers
+	optional map[string]bool
+	appUnits map[string]bool
+	mu       sync.RWMutex
+
+	// opsMu guards closing and additions to ops, the in-flight operations, and connOps, those
+	// started on the current connection
+	ops     sync.WaitGroup
+	connOps *sync.WaitGroup
+	opsMu   sync.Mutex
+	closing bool
+
+	// unitCacheMu guards unitCache
+	unitCache    map[string]cachedUnit
+	unitCacheMu  sync.Mutex
+	unitCacheTTL time.Duration
+
+	// connMu guards conn, which is replaced on Reconnect
+	conn      systemdConn
+	connMu    sync.RWMutex
+	connect   func(ctx context.Context) (*dbus.Conn, error)
+	ownsConn  bool
+	watchdog  time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// managerBusMu guards managerBus, the connection for manager methods not provided by go-systemd
+	managerBus   *dbus_direct.Conn
+	managerBusMu sync.Mutex
+}
+
+type ControllerOption func(*SystemdController)
+
+// WithStartTimeout sets how long StartUnit waits for a unit to become active after its start job
+// completed; it must be positive.
+func WithStartTimeout(timeout time.Duration) ControllerOption {
+	return func(c *SystemdController) {
+		if timeout <= 0 {
+			c.optionErrs = append(c.optionErrs, fmt.Errorf("start timeout must be positive, got %s", timeout))
+			return
+		}
+		c.startTimeout = timeout
+	}
+}
+
+// WithWatchInterval sets how often WatchUnit polls the watched unit's state; it must be positive.
+func WithWatchInterval(interval time.Duration) ControllerOption {
+	return func(c *SystemdController) {
+		if interval <= 0 {
+			c.optionErrs = append(c.optionErrs, fmt.Errorf("watch interval must be positive, got %s", interval))
+			return
+		}
+		c.watchInterval = interval
+	}
+}
+
+// WithAllowedUnitTypes restricts the controller to units with the given suffixes, e.g. ".service"
+// and ".target". By default, all unit types are allowed.
+func WithAllowedUnitTypes(suffixes ...string) ControllerOption {
+	return func(c *SystemdController) {
+		c.allowedTypes = suffixes
+	}
+}
+
+// WithReconnectWatchdog checks the dbus connection at the given interval and reconnects
+// automatically if it dropped. Only effective for controllers created with NewController.
+func WithReconnectWatchdog(interval time.Duration) ControllerOption {
+	return func(c *SystemdController) {
+		c.watchdog = interval
+	}
+}
+
+// WithUnitCache caches FindUnit lookups for ttl, e.g. for frequent health checks. Operations changing
+// a unit bypass and invalidate its entry. The cache is disabled by default.
+func WithUnitCache(ttl time.Duration) ControllerOption {
+	return func(c *SystemdController) {
+		c.unitCacheTTL = ttl
+	}
+}
+
+// WithDryRun makes StartApplication only assemble the transient service and return the equivalent
+// systemd-run command as status, without starting anything.
+func WithDryRun(enabled bool) ControllerOption {
+	return func(c *SystemdController) {
+		c.dryRun = enabled
+	}
+}
+
+// AppSpec describes how an application is run as transient service, without shell parsing.
+type AppSpec struct {
+	// Executable and arguments; an executable equal to the application name or 'run-waypipe'
+	// is resolved in the bin path
+	Exec []string
+	// Additional environment variables
+	Env map[string]string
+	// Working directory; an absolute path, or empty for the manager's default
+	WorkingDir string
+}
+
+func (spec AppSpec) validate() error {
+	if len(spec.Exec) < 1 || spec.Exec[0] == "" {
+		return fmt.Errorf("no executable given")
+	}
+	for key := range spec.Env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+	}
+	if spec.WorkingDir != "" && !filepath.IsAbs(spec.WorkingDir) {
+		return fmt.Errorf("working directory %s is not an absolute path", spec.WorkingDir)
+	}
+	return nil
+}
+
+// WithApplicationSpecs adds applications given as AppSpec, in addition to the command strings
+// passed to the constructor.
+func WithApplicationSpecs(specs map[string]AppSpec) ControllerOption {
+	return func(c *SystemdController) {
+		if c.applications == nil {
+			c.applications = make(map[string]AppSpec, len(specs))
+		}
+		for appName, spec := range specs {
+			c.applications[appName] = spec
+		}
+	}
+}
+
+// WithLogger routes the controller's logging to the given logger, e.g. to set its level independently
+// of the standard logger, which is used by default.
+func WithLogger(logger log.FieldLogger) ControllerOption {
+	return func(c *SystemdController) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// WithUnwhitelistedReads lets read-only operations, e.g. GetUnitStatus, GetUnitProperties, and
+// ListUnits, access any unit, e.g. for diagnostic tooling. All operations changing units still
+// require whitelisted units.
+func WithUnwhitelistedReads(allow bool) ControllerOption {
+	return func(c *SystemdController) {
+		c.unwhitelistedReads = allow
+	}
+}
+
+// WithBinPath sets the directory executables are resolved in, e.g. for non-NixOS systems.
+// Executables not found there are looked up in $PATH.
+func WithBinPath(path string) ControllerOption {
+	return func(c *SystemdController) {
+		c.binPath = path
+	}
+}
+
+// WithBusAddress connects to the systemd manager on the given dbus address, e.g. a unix socket
+// proxied from another VM, instead of the local system or user bus. The bus must accept
+// anonymous or external authentication and the Hello call, i.e., be served by a dbus daemon.
+// systemMode selects whether the remote manager is a system or user instance. Methods reading
+// the local host return ErrRemoteManager, i.e., unit logs, processes, and exec probes.
+func WithBusAddress(address string, systemMode bool) ControllerOption {
+	return func(c *SystemdController) {
+		c.busAddress = address
+		c.systemMode = systemMode
+	}
+}
+
+// NewController connects to the systemd manager and validates the whitelist. Entries with a
+// trailing '?', e.g. 'foo.service?', are optional and may be missing.
+func NewController(whitelist []string, applications map[string]string, opts ...ControllerOption) (_ *SystemdController, err error) {
+
+	c := newController(util.IsRoot(), opts...)
+
+	// Create dbus connector
+	var connect func(ctx context.Context) (*dbus.Conn, error)
+	switch {
+	case c.busAddress != "":
+		address := c.busAddress
+		connect = func(ctx context.Context) (*dbus.Conn, error) {
+			return dbus.NewConnection(func() (*dbus_direct.Conn, error) {
+				return dialBus(ctx, address)
+			})
+		}
+	case c.systemMode:
+		connect = dbus.NewSystemConnectionContext
+	default:
+		connect = dbus.NewUserConnectionContext
+	}
+	conn, err := connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	// Close connection on any failure during initialization
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	c.conn = conn
+	err = c.init(whitelist, applications)
+	if err != nil {
+		return nil, err
+	}
+	c.ownsConn = true
+	c.connect = connect
+	if c.watchdog > 0 {
+		go c.watchConnection(c.watchdog)
+	}
+
+	return c, nil
+}
+
+// NewControllerWithConn creates a controller on an existing connection, e.g. to share it between
+// controllers. The connection is not closed by the controller. As with NewController, the
+// connection is assumed to be to the system manager when running as root.
+func NewControllerWithConn(conn *dbus.Conn, whitelist []string, applications map[string]string, opts ...ControllerOption) (*SystemdController, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("dbus connection cannot be nil")
+	}
+	return newControllerWithConn(conn, util.IsRoot(), whitelist, applications, opts...)
+}
+
+// newControllerWithConn creates a controller on any systemdConn, e.g. a fake manager.
+func newControllerWithConn(conn systemdConn, systemMode bool, whitelist []string, applications map[string]string, opts ...ControllerOption) (*SystemdController, error) {
+	c := newController(systemMode, opts...)
+	c.conn = conn
+	err := c.init(whitelist, applications)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newController returns a controller with defaults and the options applied, but no connection.
+func newController(systemMode bool, opts ...ControllerOption) *SystemdController {
+	c := &SystemdController{
+		done:          make(chan struct{}),
+		systemMode:    systemMode,
+		startTimeout:  DefaultStartTimeout,
+		watchInterval: DefaultWatchInterval,
+		binPath:       DefaultBinPath,
+		logStreamSize: DefaultLogStreamSize,
+		metrics:       noopMetrics{},
+		logger:        log.StandardLogger(),
+		unitCache:     make(map[string]cachedUnit),
+		appUnits:      make(map[string]bool),
+		connOps:       &sync.WaitGroup{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// init validates the whitelist and application commands against the connected manager. Legacy
+// command strings are split into AppSpecs and merged with those set by WithApplicationSpecs.
+func (c *SystemdController) init(whitelist []string, applications map[string]string) error {
+
+	// Check unit whitelist and application commands, reporting all invalid entries at once
+	var errs []error
+	c.whitelist, c.optional, errs = c.parseWhitelist(whitelist)
+	errs = append(c.optionErrs, errs...)
+	specs := make(map[string]AppSpec, len(c.applications)+len(applications))
+	for appName, spec := range c.applications {
+		specs[appName] = spec
+	}
+	for appName, appCmd := range applications {
+		if _, ok := specs[appName]; ok {
+			errs = append(errs, fmt.Errorf("application %s is defined twice", appName))
+			continue
+		}
+		exec, err := splitCommand(appCmd)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid command for application %s: %w", appName, err))
+			continue
+		}
+		specs[appName] = AppSpec{Exec: exec}
+	}
+	for appName, spec := range specs {
+		if !isSafeName(appName) {
+			errs = append(errs, fmt.Errorf("invalid application name %q, must be a plain file name", appName))
+			continue
+		}
+		err := spec.validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid application %s: %w", appName, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	c.applications = specs
+
+	return nil
+}
+
+// checkLocalHost returns ErrRemoteManager if the controller manages a remote manager, whose
+// units cannot be inspected through the local host.
+func (c *SystemdController) checkLocalHost(op string) error {
+	if c.busAddress != "" {
+		return fmt.Errorf("%w: cannot %s on bus %s", ErrRemoteManager, op, c.busAddress)
+	}
+	return nil
+}
+
+// dialBus opens a private connection to the bus at address and authenticates it.
+func dialBus(ctx context.Context, address string) (*dbus_direct.Conn, error) {
+	conn, err := dbus_direct.Dial(address, dbus_direct.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to bus %s: %v", address, err)
+	}
+	return authBus(conn, "bus "+address)
+}
+
+// dialManagerBus opens a private connection to the bus of the controller's manager, for manager
+// methods not provided by go-systemd.
+func (c *SystemdController) dialManagerBus(ctx context.Context) (*dbus_direct.Conn, error) {
+	if c.busAddress != "" {
+		return dialBus(ctx, c.busAddress)
+	}
+	dial, bus := dbus_direct.SessionBusPrivate, "session bus"
+	if c.systemMode {
+		dial, bus = dbus_direct.SystemBusPrivate, "system bus"
+	}
+	conn, err := dial(dbus_direct.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s: %v", bus, err)
+	}
+	return authBus(conn, bus)
+}
+
+// callManager calls a method of the systemd manager on a dedicated connection, which is kept
+// for later calls. The bus of an externally provided connection is unknown, so calling its
+// manager is not supported.
+func (c *SystemdController) callManager(ctx context.Context, method string, args ...interface{}) error {
+	if c.connect == nil {
+		return fmt.Errorf("%s not supported for externally provided connection", method)
+	}
+	conn, err := c.managerConn()
+	if err != nil {
+		return err
+	}
+	obj := conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1")
+	return obj.CallWithContext(ctx, "org.freedesktop.systemd1.Manager."+method, 0, args...).Err
+}
+
+// managerConn returns the dedicated manager connection, dialing it if needed. It is dialed
+// detached from any call's context, as godbus closes a connection once that context is done.
+func (c *SystemdController) managerConn() (*dbus_direct.Conn, error) {
+	c.managerBusMu.Lock()
+	defer c.managerBusMu.Unlock()
+
+	if c.isClosing() {
+		return nil, fmt.Errorf("%w: controller is closed", ErrNotConnected)
+	}
+	if c.managerBus != nil && c.managerBus.Connected() {
+		return c.managerBus, nil
+	}
+	conn, err := c.dialManagerBus(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	c.managerBus = conn
+	return conn, nil
+}
+
+// authBus authenticates the private connection and registers it on the bus; it is closed on failure.
+func authBus(conn *dbus_direct.Conn, bus string) (*dbus_direct.Conn, error) {
+	err := conn.Auth(nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot authenticate to %s: %v", bus, err)
+	}
+	err = conn.Hello()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot register on %s: %v", bus, err)
+	}
+	return conn, nil
+}
+
+// Close waits up to DefaultCloseTimeout for in-flight operations and closes the connection.
+func (c *SystemdController) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCloseTimeout)
+	defer cancel()
+	err := c.CloseContext(ctx)
+	if err != nil {
+		c.logger.Warnf("closing systemd controller: %v", err)
+	}
+}
+
+// CloseContext waits for in-flight operations until the context is done and closes the connection.
+// Operations started meanwhile are not waited for. The connection is closed even if waiting was aborted.
+func (c *SystemdController) CloseContext(ctx context.Context) error {
+
+	c.opsMu.Lock()
+	c.closing = true
+	c.opsMu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		c.ops.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("in-flight operations did not complete: %w", ctx.Err())
+	}
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	if c.ownsConn {
+		c.dbusConn().Close()
+	}
+	c.managerBusMu.Lock()
+	if c.managerBus != nil {
+		c.managerBus.Close()
+		c.managerBus = nil
+	}
+	c.managerBusMu.Unlock()
+	return err
+}
+
+// isClosing reports whether Close was called.
+func (c *SystemdController) isClosing() bool {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	return c.closing
+}
+
+// trackOp registers an in-flight operation for CloseContext and returns the function ending it.
+// Operations started while closing are not tracked and fail on the closed connection.
+func (c *SystemdController) trackOp() func() {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	if c.closing {
+		return func() {}
+	}
+	c.ops.Add(1)
+	connOps := c.connOps
+	connOps.Add(1)
+	return func() {
+		connOps.Done()
+		c.ops.Done()
+	}
+}
+
+// dbusConn returns the current connection, which may be replaced by Reconnect.
+func (c *SystemdController) dbusConn() systemdConn {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.conn
+}
+
+// IsSystemMode reports whether the controller manages the system manager rather than a user manager.
+func (c *SystemdController) IsSystemMode() bool {
+	return c.systemMode
+}
+
+// IsConnected reports whether the dbus connection is still usable.
+func (c *SystemdController) IsConnected() bool {
+	return c.dbusConn().Connected()
+}
+
+// Reconnect replaces the dbus connection with a new one to the same manager and re-validates
+// the configured whitelist. The context only bounds waiting for the connection, not its lifetime.
+// It is only supported for controllers created with NewController.
+func (c *SystemdController) Reconnect(ctx context.Context) error {
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if c.connect == nil {
+		return fmt.Errorf("reconnect not supported for externally provided connection")
+	}
+
+	if c.isClosing() {
+		return fmt.Errorf("%w: controller is closed", ErrNotConnected)
+	}
+
+	// Dial detached from ctx, which only bounds the wait; godbus closes a connection once the
+	// context it was dialed with is done
+	type dialResult struct {
+		conn *dbus.Conn
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		conn, err := c.connect(context.Background())
+		dialed <- dialResult{conn, err}
+	}()
+	var conn *dbus.Conn
+	select {
+	case result := <-dialed:
+		if result.err != nil {
+			return fmt.Errorf("cannot reconnect to dbus: %v", result.err)
+		}
+		conn = result.conn
+	case <-ctx.Done():
+		go func() {
+			result := <-dialed
+			if result.err == nil {
+				result.conn.Close()
+			}
+		}()
+		return fmt.Errorf("cannot reconnect to dbus: %w", ctx.Err())
+	}
+
+	// Replace connection unless the controller was closed meanwhile, which would leak the new
+	// one. The old connection is closed once the operations using it completed; new operations
+	// are tracked on the new connection only after it is in place.
+	c.opsMu.Lock()
+	if c.closing {
+		c.opsMu.Unlock()
+		conn.Close()
+		return fmt.Errorf("%w: controller is closed", ErrNotConnected)
+	}
+	c.connMu.Lock()
+	oldConn := c.conn
+	c.conn = conn
+	c.connMu.Unlock()
+	oldOps := c.connOps
+	c.connOps = &sync.WaitGroup{}
+	c.opsMu.Unlock()
+	go func() {
+		oldOps.Wait()
+		oldConn.Close()
+	}()
+	c.logger.Infof("systemd controller reconnected to dbus")
+	c.invalidateUnit("")
+
+	// Re-validate configured whitelist; application services may have been unloaded meanwhile
+	c.mu.RLock()
+	whitelist := slices.Clone(c.whitelist)
+	optional := maps.Clone(c.optional)
+	c.mu.RUnlock()
+	var errs []error
+	for _, name := range whitelist {
+		err := c.checkWhitelistEntry(name, optional[name])
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("reconnected, but whitelist validation failed: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// watchConnection reconnects whenever the connection dropped, until the controller is closed.
+func (c *SystemdController) watchConnection(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		// Both channels may be ready after Close, the closed connection is expected then
+		if c.isClosing() {
+			return
+		}
+		if c.IsConnected() {
+			continue
+		}
+		c.logger.Infof("systemd controller lost dbus connection, reconnecting")
+		err := c.Reconnect(context.Background())
+		if err != nil {
+			c.logger.Errorf("systemd controller watchdog: %v", err)
+		}
+	}
+}
+
+// ReloadWhitelist validates the new whitelist and replaces the current one. If any mandatory entry
+// cannot be found, the current whitelist is kept and all failures are returned. Application
+// services started with StartApplication stay whitelisted.
+func (c *SystemdController) ReloadWhitelist(whitelist []string) error {
+
+	newWhitelist, optional, errs := c.parseWhitelist(whitelist)
+	if len(errs) > 0 {
+		return fmt.Errorf("whitelist not reloaded: %w", errors.Join(errs...))
+	}
+
+	c.mu.Lock()
+	c.whitelist = newWhitelist
+	c.optional = optional
+	c.mu.Unlock()
+
+	return nil
+}
+
+// parseWhitelist strips the optional marker, a trailing '?', from the entries and validates them.
+// Optional units that are not found are kept, so they are whitelisted once they appear. Duplicate
+// entries are removed with a warning; a unit listed both ways is mandatory.
+func (c *SystemdController) parseWhitelist(entries []string) ([]string, map[string]bool, []error) {
+
+	// Remove duplicates, keeping the first occurrence
+	var duplicates []string
+	names := make([]string, 0, len(entries))
+	mandatory := make(map[string]bool)
+	for _, entry := range entries {
+		name, isOptional := strings.CutSuffix(entry, "?")
+		if _, seen := mandatory[name]; seen {
+			duplicates = append(duplicates, name)
+		} else {
+			names = append(names, name)
+		}
+		mandatory[name] = mandatory[name] || !isOptional
+	}
+	if len(duplicates) > 0 {
+		c.logger.WithField("entries", duplicates).Warn("duplicate whitelist entries removed")
+	}
+
+	// Validate entries
+	var errs []error
+	optional := make(map[string]bool)
+	for _, name := range names {
+		if !mandatory[name] {
+			optional[name] = true
+		}
+		err := c.checkWhitelistEntry(name, optional[name])
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return names, optional, errs
+}
+
+func (c *SystemdController) checkWhitelistEntry(name string, optional bool) error {
+	err := c.validateWhitelistEntry(name)
+	if err != nil && optional && errors.Is(err, ErrUnitNotFound) {
+		c.unitLog(name, "validate").Info("optional whitelist entry not found, skipping")
+		return nil
+	}
+	return err
+}
+
+// validateWhitelistEntry checks the entry's unit type and that the unit exists.
+func (c *SystemdController) validateWhitelistEntry(name string) error {
+	err := c.checkUnitType(name)
+	if err != nil {
+		return err
+	}
+	if isGlob(name) {
+		return nil
+	}
+	_, err = c.lookupUnit(name)
+	return err
+}
+
+// checkUnitType returns ErrUnitType if the unit's suffix is not in the allowed types.
+func (c *SystemdController) checkUnitType(name string) error {
+	if len(c.allowedTypes) == 0 || slices.Contains(c.allowedTypes, filepath.Ext(name)) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s, must be one of %v", ErrUnitType, name, c.allowedTypes)
+}
+
+// Whitelist returns a copy of the current whitelist, including dynamically added applications.
+func (c *SystemdController) Whitelist() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	whitelist := slices.Clone(c.whitelist)
+	var appUnits []string
+	for name := range c.appUnits {
+		if !slices.Contains(whitelist, name) {
+			appUnits = append(appUnits, name)
+		}
+	}
+	slices.Sort(appUnits)
+	return append(whitelist, appUnits...)
+}
+
+// canRead reports whether read-only operations may access the unit.
+func (c *SystemdController) canRead(name string) bool {
+	return c.unwhitelistedReads || c.IsUnitWhitelisted(name)
+}
+
+// IsUnitWhitelisted reports whether the name matches a whitelist entry. Entries may be
+// filepath.Match globs, e.g. 'chromium@*.service' allows every chromium instance through
+// all other methods; entries without glob metacharacters must match exactly.
+func (c *SystemdController) IsUnitWhitelisted(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.appUnits[name] {
+		return true
+	}
+	for _, val := range c.whitelist {
+		if val == name {
+			return true
+		}
+		if isGlob(val) {
+			if ok, _ := filepath.Match(val, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isGlob reports whether the whitelist entry contains glob metacharacters. Glob entries
+// cannot be resolved to units up front and are skipped when validating the whitelist.
+func isGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[\\")
+}
+
+// FindUnit returns the whitelisted unit. With WithUnitCache, results may be served from the cache
+// and reflect the unit's state at lookup time; use GetUnitStatus for its current state.
+func (c *SystemdController) FindUnit(name string) ([]dbus.UnitStatus, error) {
+	return c.findUnit(name, lookupCached)
+}
+
+type unitLookup int
+
+const (
+	// lookupCached requires a whitelisted unit and may be served from the cache
+	lookupCached unitLookup = iota
+	// lookupLive requires a whitelisted unit and drops its cached entry, for operations changing it
+	lookupLive
+	// lookupRead is lookupCached for read-only operations, which WithUnwhitelistedReads lifts the
+	// whitelist requirement of
+	lookupRead
+	// lookupState is lookupRead for read-only callers of the unit state; only the unit's
+	// existence is served from the cache, its ActiveState and SubState are re-read
+	lookupState
+)
+
+// findUnit looks up the unit, checking the whitelist according to the lookup kind. Lookups of
+// units only readable through WithUnwhitelistedReads are not cached, so arbitrary names cannot
+// grow the cache.
+func (c *SystemdController) findUnit(name string, lookup unitLookup) ([]dbus.UnitStatus, error) {
+
+	whitelisted := c.IsUnitWhitelisted(name)
+	read := lookup == lookupRead || lookup == lookupState
+	if !whitelisted && !(read && c.unwhitelistedReads) {
+		return nil, fmt.Errorf("%w: %s", ErrNotWhitelisted, name)
+	}
+	err := c.checkUnitType(name)
+	if err != nil {
+		return nil, err
+	}
+	if c.unitCacheTTL <= 0 || !whitelisted {
+		return c.lookupUnit(name)
+	}
+	if lookup == lookupLive {
+		c.invalidateUnit(name)
+		return c.lookupUnit(name)
+	}
+
+	c.unitCacheMu.Lock()
+	entry, ok := c.unitCache[name]
+	c.unitCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		if lookup == lookupState {
+			return c.refreshUnits(name, entry.units)
+		}
+		return slices.Clone(entry.units), nil
+	}
+	units, err := c.lookupUnit(name)
+	if err != nil {
+		return nil, err
+	}
+	c.unitCacheMu.Lock()
+	c.unitCache[name] = cachedUnit{units: slices.Clone(units), expires: time.Now().Add(c.unitCacheTTL)}
+	c.unitCacheMu.Unlock()
+
+	return units, nil
+}
+
+// refreshUnits re-reads the status of the units cached for name, dropping the entry if a unit is gone.
+func (c *SystemdController) refreshUnits(name string, cached []dbus.UnitStatus) ([]dbus.UnitStatus, error) {
+	names := make([]string, 0, len(cached))
+	for _, unit := range cached {
+		names = append(names, unit.Name)
+	}
+	units, err := c.dbusConn().ListUnitsByNamesContext(context.Background(), names)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get state of units %s: %v", strings.Join(names, ", "), err)
+	}
+	for _, unit := range units {
+		if unit.LoadState == "not-found" {
+			c.invalidateUnit(name)
+			return nil, fmt.Errorf("%w: %s", ErrUnitNotFound, unit.Name)
+		}
+	}
+	return units, nil
+}
+
+type cachedUnit struct {
+	units   []dbus.UnitStatus
+	expires time.Time
+}
+
+// invalidateUnit drops the cached lookup of the unit, or of all units if name is empty.
+func (c *SystemdController) invalidateUnit(name string) {
+	c.unitCacheMu.Lock()
+	defer c.unitCacheMu.Unlock()
+	if name == "" {
+		clear(c.unitCache)
+		return
+	}
+	delete(c.unitCache, name)
+}
+
+// lookupUnit queries systemd for the unit without checking the whitelist.
+func (c *SystemdController) lookupUnit(name string) ([]dbus.UnitStatus, error) {
+
+	if !c.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
+	var err error
+	var units []dbus.UnitStatus
+	units, err = c.dbusConn().ListUnitsByNamesContext(context.Background(), []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find unit with name %s: %v", name, err)
+	}
+	// systemd reports unknown names as 'not-found' rather than omitting them
+	if len(units) < 1 || units[0].LoadState == "not-found" {
+		return nil, fmt.Errorf("%w: no units found with name %s", ErrUnitNotFound, name)
+	}
+	return units, err
+}
+
+// dbusErrorName returns the name of a dbus error, e.g. 'org.freedesktop.systemd1.NoSuchUnit', or
+// an empty string for other errors.
+func dbusErrorName(err error) string {
+	var dbusErr dbus_direct.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr.Name
+	}
+	var dbusErrPtr *dbus_direct.Error
+	if errors.As(err, &dbusErrPtr) {
+		return dbusErrPtr.Name
+	}
+	return ""
+}
+
+// unitOpError translates the dbus error of a unit that vanished after it was found into
+// ErrUnitNotFound, and authorization failures into ErrPermissionDenied. Other errors are
+// returned unchanged.
+func unitOpError(name string, err error) error {
+	switch dbusErrorName(err) {
+	case "org.freedesktop.systemd1.NoSuchUnit", "org.freedesktop.DBus.Error.UnknownObject":
+		return fmt.Errorf("%w: %s: %v", ErrUnitNotFound, name, err)
+	case "org.freedesktop.DBus.Error.AccessDenied", "org.freedesktop.DBus.Error.InteractiveAuthorizationRequired":
+		return fmt.Errorf("%w %s: %v", ErrPermissionDenied, name, err)
+	}
+	return err
+}
+
+// FindUnitFiles returns the unit files matching name in any of the given enablement states,
+// e.g. 'enabled', 'disabled', 'static', or 'masked'. Without states, files in all states are returned.
+func (c *SystemdController) FindUnitFiles(name string, states ...string) ([]dbus.UnitFile, error) {
+
+	ok := c.IsUnitWhitelisted(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotWhitelisted, name)
+	}
+	err := c.checkUnitType(name)
+	if err != nil {
+		return nil, err
+	}
+
+	units, err := c.dbusConn().ListUnitFilesByPatternsContext(context.Background(), states, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find unit with name %s: %v", name, err)
+	}
+	if len(units) < 1 {
+		return nil, fmt.Errorf("%w: no units found with name %s", ErrUnitNotFound, name)
+	}
+
+	return units, err
+}
+
+// UnitFileExists reports whether a unit file for the whitelisted unit is installed, regardless of
+// whether the unit is loaded or enabled.
+func (c *SystemdController) UnitFileExists(ctx context.Context, name string) (bool, error) {
+
+	// Input validation
+	if ctx == nil {
+		return false, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return false, fmt.Errorf("incorrect input, must be unit name")
+	}
+	if !c.IsUnitWhitelisted(name) {
+		return false, fmt.Errorf("%w: %s", ErrNotWhitelisted, name)
+	}
+	err := c.checkUnitType(name)
+	if err != nil {
+		return false, err
+	}
+
+	// List unit files in all states
+	files, err := c.dbusConn().ListUnitFilesByPatternsContext(ctx, nil, []string{name})
+	if err != nil {
+		return false, fmt.Errorf("cannot list unit files with name %s: %v", name, err)
+	}
+
+	return len(files) > 0, nil
+}
+
+func (c *SystemdController) FindUnitsByPattern(name string, states string) ([]dbus.UnitStatus, error) {
+
+	ok := c.IsUnitWhitelisted(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotWhitelisted, name)
+	}
+	err := c.checkUnitType(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var units []dbus.UnitStatus
+	units, err = c.dbusConn().ListUnitsByPatternsContext(context.Background(), []string{states}, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find unit with name %s: %v", name, err)
+	}
+	if len(units) < 1 {
+		return nil, fmt.Errorf("%w: no units found with name %s", ErrUnitNotFound, name)
+	}
+	return units, nil
+}
+
+// ListInstances returns the names of the running whitelisted instances of a template unit, e.g.
+// 'chromium@1.service' for 'chromium@.service'.
+func (c *SystemdController) ListInstances(ctx context.Context, template string) ([]string, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	pattern, err := instancePattern(template)
+	if err != nil {
+		return nil, err
+	}
+
+	// List instances
+	units, err := c.dbusConn().ListUnitsByPatternsContext(ctx, []string{"active", "activating", "reloading"}, []string{pattern})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list instances of %s: %v", template, err)
+	}
+
+	var names []string
+	for _, unit := range units {
+		if c.IsUnitWhitelisted(unit.Name) && c.checkUnitType(unit.Name) == nil {
+			names = append(names, unit.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// StopAllInstances stops all running instances of a template unit and resets failed instances.
+// The instance pattern, e.g. 'chromium@*.service', must be whitelisted. The result holds an entry
+// for every instance, nil on success; the error is only set if the instances cannot be listed.
+func (c *SystemdController) StopAllInstances(ctx context.Context, template string) (map[string]error, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	pattern, err := instancePattern(template)
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsUnitWhitelisted(pattern) {
+		return nil, fmt.Errorf("%w: %s", ErrNotWhitelisted, pattern)
+	}
+	err = c.checkUnitType(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// List instances
+	units, err := c.dbusConn().ListUnitsByPatternsContext(ctx, []string{"active", "activating", "reloading", "failed"}, []string{pattern})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list instances of %s: %v", template, err)
+	}
+
+	// Stop or reset instance(s)
+	results := make(map[string]error, len(units))
+	for _, unit := range units {
+		if unit.ActiveState == "failed" {
+			results[unit.Name] = c.ResetFailedUnit(ctx, unit.Name)
+			continue
+		}
+		_, results[unit.Name] = c.StopUnit(ctx, unit.Name)
+	}
+
+	return results, nil
+}
+
+// instancePattern returns the glob matching all instances of a template unit like 'foo@.service'.
+func instancePattern(template string) (string, error) {
+	prefix, suffix, ok := strings.Cut(template, "@")
+	if !ok || prefix == "" || !strings.HasPrefix(suffix, ".") || strings.ContainsAny(template, "*?[") {
+		return "", fmt.Errorf("incorrect input, %s is not a template unit", template)
+	}
+	return prefix + "@*" + suffix, nil
+}
+
+// StartUnit starts the unit; a unit that is already running is left untouched.
+func (c *SystemdController) StartUnit(ctx context.Context, name string) (*JobResult, error) {
+	return c.startUnitJob(ctx, name, "start", systemdConn.StartUnitContext, false)
+}
+
+// StartUnitForce starts the unit like StartUnit, but first resets it if it is failed, e.g. after
+// hitting its start rate limit, which systemd otherwise refuses to start.
+func (c *SystemdController) StartUnitForce(ctx context.Context, name string) (*JobResult, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reset failed unit(s)
+	for _, targetUnit := range units {
+		if targetUnit.ActiveState == "failed" {
+			err := c.ResetFailedUnit(ctx, targetUnit.Name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c.StartUnit(ctx, name)
+}
+
+// RestartUnit restarts the unit, or starts it if it is not running.
+func (c *SystemdController) RestartUnit(ctx context.Context, name string) (*JobResult, error) {
+	return c.startUnitJob(ctx, name, "restart", systemdConn.RestartUnitContext, false)
+}
+
+// ReloadOrRestartUnit reloads the unit if it supports reloading, otherwise restarts it.
+func (c *SystemdController) ReloadOrRestartUnit(ctx context.Context, name string) (*JobResult, error) {
+	return c.startUnitJob(ctx, name, "reload-or-restart", systemdConn.ReloadOrRestartUnitContext, false)
+}
+
+// TryRestartUnit restarts the unit if it is running, and succeeds as a no-op otherwise.
+func (c *SystemdController) TryRestartUnit(ctx context.Context, name string) (*JobResult, error) {
+	return c.startUnitJob(ctx, name, "try-restart", systemdConn.TryRestartUnitContext, true)
+}
+
+// TryStartUnit queues a start job for the unit and returns its job path without waiting for it to
+// complete, e.g. to bring up many units concurrently and observe them with WatchUnit or ListJobs.
+func (c *SystemdController) TryStartUnit(ctx context.Context, name string) (jobPath string, err error) {
+	defer c.beginOp(ctx, name, "try-start")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return "", fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return "", fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return "", err
+	}
+
+	// Queue start job; go-systemd does not report the result on a nil channel
+	var jobID int
+	err = c.withRetry(ctx, func() (err error) {
+		jobID, err = c.dbusConn().StartUnitContext(ctx, units[0].Name, "replace", nil)
+		return err
+	})
+	if err != nil {
+		return "", unitOpError(units[0].Name, err)
+	}
+	result := newJobResult(jobID, units[0].Name)
+	c.unitLog(name, "try-start").WithField("job", jobID).Info("start job queued")
+
+	return result.Path, nil
+}
+
+// EnsureUnitState starts or stops the unit only if its ActiveState differs from desired, which
+// is either 'active' or 'inactive'. A failed unit is considered inactive.
+func (c *SystemdController) EnsureUnitState(ctx context.Context, name string, desired string) error {
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+	if desired != "active" && desired != "inactive" {
+		return fmt.Errorf("incorrect input, desired state must be 'active' or 'inactive'")
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+	current := units[0].ActiveState
+
+	// Converge unit state; StartUnit already waits for the unit to become active
+	switch desired {
+	case "active":
+		if current == "active" {
+			return nil
+		}
+		_, err := c.StartUnit(ctx, name)
+		return err
+	default:
+		if current == "inactive" || current == "failed" {
+			return nil
+		}
+		_, err := c.StopUnit(ctx, name)
+		if err != nil {
+			return err
+		}
+		units, err := c.findUnit(name, lookupLive)
+		if err != nil {
+			return err
+		}
+		if units[0].ActiveState != "inactive" && units[0].ActiveState != "failed" {
+			return fmt.Errorf("unit %s is %s after stop", name, units[0].ActiveState)
+		}
+		return nil
+	}
+}
+
+// StartUnits attempts to start all units in the given order without failing fast. The result
+// holds an entry for every unit, nil on success; the error is only set for invalid input.
+func (c *SystemdController) StartUnits(ctx context.Context, names []string) (map[string]error, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+
+	// Start unit(s)
+	results := make(map[string]error, len(names))
+	for _, name := range names {
+		_, results[name] = c.StartUnit(ctx, name)
+	}
+
+	return results, nil
+}
+
+// StopUnitsOrdered stops the units in reverse start order as given by their After and Before
+// relationships, so dependents are stopped before the units they are ordered after. Units
+// without ordering between them keep the given order. The result holds an entry for every unit,
+// nil on success; the error is only set for invalid input.
+func (c *SystemdController) StopUnitsOrdered(ctx context.Context, names []string) (map[string]error, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("incorrect input, must be unit name")
+		}
+	}
+
+	// Get ordering of unit(s)
+	results := make(map[string]error, len(names))
+	var ordered []string
+	deps := make(map[string]*UnitDeps, len(names))
+	for _, name := range names {
+		if _, ok := results[name]; ok {
+			continue
+		}
+		deps[name], results[name] = c.GetUnitDependencies(ctx, name)
+		if results[name] == nil {
+			ordered = append(ordered, name)
+		}
+	}
+
+	// Stop unit(s)
+	for _, name := range stopOrder(ordered, deps) {
+		_, results[name] = c.StopUnit(ctx, name)
+	}
+
+	return results, nil
+}
+
+// stopOrder sorts the units topologically so that a unit is stopped before every unit it is
+// ordered after. Ties keep the given order; on an ordering cycle, the remaining units are
+// appended as given.
+func stopOrder(names []string, deps map[string]*UnitDeps) []string {
+
+	// 'before' lists the units to stop after each unit
+	before := make(map[string][]string, len(names))
+	pending := make(map[string]int, len(names))
+	for _, name := range names {
+		pending[name] = 0
+	}
+	addEdge := func(first, second string) {
+		if _, ok := pending[first]; !ok || first == second {
+			return
+		}
+		if _, ok := pending[second]; !ok || slices.Contains(before[first], second) {
+			return
+		}
+		before[first] = append(before[first], second)
+		pending[second]++
+	}
+	for _, name := range names {
+		for _, after := range deps[name].After {
+			addEdge(name, after)
+		}
+		for _, dependent := range deps[name].Before {
+			addEdge(dependent, name)
+		}
+	}
+
+	var order []string
+	done := make(map[string]bool, len(names))
+	for len(order) < len(names) {
+		progress := false
+		for _, name := range names {
+			if done[name] || pending[name] > 0 {
+				continue
+			}
+			done[name] = true
+			order = append(order, name)
+			for _, next := range before[name] {
+				pending[next]--
+			}
+			progress = true
+			break
+		}
+		if !progress {
+			for _, name := range names {
+				if !done[name] {
+					done[name] = true
+					order = append(order, name)
+				}
+			}
+		}
+	}
+
+	return order
+}
+
+// OneshotResult holds the exit status of the main process of a oneshot service.
+type OneshotResult struct {
+	// ExecMainCode, i.e., CLD_EXITED (1), or CLD_KILLED (2) and CLD_DUMPED (3) if terminated by a signal
+	Code int32
+	// ExecMainStatus, i.e., the exit code, or the signal number if terminated by a signal
+	Status      int32
+	ActiveState string
+}
+
+// RunOneshotUnit starts a Type=oneshot service, waits for it to finish, and returns the exit status
+// of its main process. A non-zero exit is not an error; it is reported in the result.
+func (c *SystemdController) RunOneshotUnit(ctx context.Context, name string) (_ *OneshotResult, err error) {
+	defer c.beginOp(ctx, name, "run-oneshot")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	if !strings.HasSuffix(name, ".service") {
+		return nil, fmt.Errorf("%w: unit %s is not a service", ErrUnitType, name)
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+	unitName := units[0].Name
+	props, err := c.dbusConn().GetAllPropertiesContext(ctx, unitName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get properties of unit %s: %v", name, err)
+	}
+	if serviceType, _ := props["Type"].(string); serviceType != "oneshot" {
+		return nil, fmt.Errorf("%w: unit %s is not a oneshot service (%s)", ErrUnitType, name, serviceType)
+	}
+
+	// Start unit; a start job of a oneshot only completes once the process exited, and
+	// a failing process is expected to fail the job
+	ch := newJobChannel()
+	jobID, err := c.dbusConn().StartUnitContext(ctx, unitName, "replace", ch)
+	if err != nil {
+		return nil, unitOpError(unitName, err)
+	}
+	status, err := waitForJob(ctx, ch, "start", name)
+	if err != nil && status != "failed" {
+		return nil, err
+	}
+	c.unitLog(name, "run-oneshot").WithFields(log.Fields{"job": jobID, "result": status}).Info("oneshot run completed")
+
+	// Wait for a terminal state, i.e., the unit is no longer changing
+	ticker := time.NewTicker(unitStatePollInterval)
+	defer ticker.Stop()
+	for {
+		props, err = c.dbusConn().GetAllPropertiesContext(ctx, unitName)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get properties of unit %s: %v", name, err)
+		}
+		activeState, _ := props["ActiveState"].(string)
+		switch activeState {
+		case "activating", "deactivating", "reloading", "refreshing":
+		default:
+			result := &OneshotResult{ActiveState: activeState}
+			result.Code, _ = props["ExecMainCode"].(int32)
+			result.Status, _ = props["ExecMainStatus"].(int32)
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("unit %s did not finish: %v", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// JobResult identifies the systemd job of an operation, e.g. to correlate with 'systemctl list-jobs'.
+type JobResult struct {
+	ID   int
+	Path string
+	Unit string
+	// Job result as reported by systemd, e.g. 'done' or 'failed'; empty if not received
+	Result string
+	// Conditions of a start that did not activate the unit because a condition was not met
+	Conditions *UnitConditions
+}
+
+func newJobResult(id int, unit string) *JobResult {
+	return &JobResult{
+		ID:   id,
+		Path: fmt.Sprintf("/org/freedesktop/systemd1/job/%d", id),
+		Unit: unit,
+	}
+}
+
+// JobError is returned when a systemd job did not succeed, e.g. to retry on a 'timeout' result.
+// A 'canceled' job unwraps to context.Canceled.
+type JobError struct {
+	Unit      string
+	Operation string
+	// Job result as reported by systemd, e.g. 'failed' or 'dependency'
+	Result string
+}
+
+func (e *JobError) Error() string {
+	if e.Result == "canceled" {
+		return fmt.Sprintf("failed to %s unit %s: job %v", e.Operation, e.Unit, context.Canceled)
+	}
+	return fmt.Sprintf("failed to %s unit %s: %s (%s)", e.Operation, e.Unit, e.Result, jobResultReason(e.Result))
+}
+
+func (e *JobError) Unwrap() error {
+	if e.Result == "canceled" {
+		return context.Canceled
+	}
+	return nil
+}
+
+// JobStatus describes a queued or running systemd job.
+type JobStatus struct {
+	ID   uint32
+	Unit string
+	// Job type, e.g. 'start', 'stop', or 'restart'
+	Type string
+	// Job state, i.e., 'waiting' or 'running'
+	State string
+	Path  string
+}
+
+// ListJobs returns the pending jobs of whitelisted units, e.g. to find the job a start is blocked behind.
+func (c *SystemdController) ListJobs(ctx context.Context) ([]JobStatus, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if !c.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
+	// List jobs
+	jobs, err := c.dbusConn().ListJobsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list jobs: %v", err)
+	}
+
+	// Filter whitelisted units
+	var statuses []JobStatus
+	for _, job := range jobs {
+		if c.IsUnitWhitelisted(job.Unit) && c.checkUnitType(job.Unit) == nil {
+			statuses = append(statuses, JobStatus{
+				ID:    job.Id,
+				Unit:  job.Unit,
+				Type:  job.JobType,
+				State: job.Status,
+				Path:  string(job.JobPath),
+			})
+		}
+	}
+
+	return statuses, nil
+}
+
+// CancelJob cancels a queued or running job of a whitelisted unit, e.g. a stop blocked on a hung process.
+func (c *SystemdController) CancelJob(ctx context.Context, jobID uint32) (err error) {
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+
+	// Find job
+	jobs, err := c.dbusConn().ListJobsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot list jobs: %v", err)
+	}
+	idx := slices.IndexFunc(jobs, func(job dbus.JobStatus) bool { return job.Id == jobID })
+	if idx < 0 {
+		return fmt.Errorf("no job with id %d", jobID)
+	}
+	// Audit once the job's unit is known
+	defer c.beginOp(ctx, jobs[idx].Unit, "cancel-job")(&err)
+	if !c.IsUnitWhitelisted(jobs[idx].Unit) {
+		return fmt.Errorf("%w: %s", ErrNotWhitelisted, jobs[idx].Unit)
+	}
+	err = c.checkUnitType(jobs[idx].Unit)
+	if err != nil {
+		return err
+	}
+
+	// Cancel job; go-systemd does not provide CancelJob
+	err = c.callManager(ctx, "CancelJob", jobID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel job %d of unit %s: %w", jobID, jobs[idx].Unit, unitOpError(jobs[idx].Unit, err))
+	}
+	c.unitLog(jobs[idx].Unit, "cancel-job").WithField("job", jobID).Info("job cancelled")
+
+	return nil
+}
+
+// WaitForJobResult waits for the result of a job whose channel was passed to a go-systemd job method,
+// e.g. StartUnitContext, and maps it to an error like the controller's operations do: nil for
+// 'done' and 'skipped', a JobError otherwise, or the context's error if it is done first. The
+// channel should have a buffer of one, so go-systemd's send does not block after a cancellation.
+func WaitForJobResult(ctx context.Context, ch <-chan string, op string, unit string) (string, error) {
+	return waitForJob(ctx, ch, op, unit)
+}
+
+// newJobChannel returns a channel for the result of a go-systemd job method. It is buffered, so
+// go-systemd's send never blocks, and leaks its goroutine, if we stopped waiting early.
+func newJobChannel() chan string {
+	return make(chan string, 1)
+}
+
+// waitForJob returns the job result, or an empty result if the context is done first. The job
+// channel must be created with newJobChannel.
+func waitForJob(ctx context.Context, ch <-chan string, op string, unit string) (string, error) {
+	select {
+	case result := <-ch:
+		return result, jobResultError(op, unit, result)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// jobResultError maps a systemd job result to an error. 'done' and 'skipped' (e.g. an unmet
+// condition) are successful; all other results return a JobError.
+func jobResultError(op string, name string, result string) error {
+	switch result {
+	case "done", "skipped":
+		return nil
+	}
+	return &JobError{Unit: name, Operation: op, Result: result}
+}
+
+func jobResultReason(result string) string {
+	switch result {
+	case "timeout":
+		return "job timed out"
+	case "failed":
+		return "job failed"
+	case "dependency":
+		return "a required dependency failed"
+	case "invalid":
+		return "job is not applicable to the unit"
+	case "assert":
+		return "an assertion of the unit failed"
+	case "unsupported":
+		return "operation not supported by the unit type"
+	case "collected":
+		return "job was garbage collected"
+	case "once":
+		return "unit can only be activated once"
+	case "frozen":
+		return "unit is frozen"
+	}
+	return "unknown job result"
+}
+
+// startJobFunc is a job method expression like systemdConn.StartUnitContext, so the connection
+// is only picked once the operation is tracked.
+type startJobFunc func(conn systemdConn, ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+
+// freezerFunc is a freezer method expression like systemdConn.FreezeUnit.
+type freezerFunc func(conn systemdConn, ctx context.Context, unit string) error
+
+// startUnitJob runs the job and verifies the unit is active afterwards. With onlyIfRunning, units
+// that were not active beforehand are expected to stay down and are not verified. The job
+// result is also returned on failure once the job was queued.
+func (c *SystemdController) startUnitJob(ctx context.Context, name string, op string, startJob startJobFunc, onlyIfRunning bool) (_ *JobResult, err error) {
+	defer c.beginOp(ctx, name, op)(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	// (Re)start unit(s)
+	var result *JobResult
+	for _, targetUnit := range units {
+		err := c.checkUnitLoaded(ctx, targetUnit)
+		if err != nil {
+			return nil, err
+		}
+
+		// 'replace' already queued jobs that may conflict
+		ch := newJobChannel()
+		var jobID int
+		err = c.withRetry(ctx, func() (err error) {
+			jobID, err = startJob(c.dbusConn(), ctx, targetUnit.Name, "replace", ch)
+			return err
+		})
+		if err != nil {
+			return nil, unitOpError(targetUnit.Name, err)
+		}
+		result = newJobResult(jobID, targetUnit.Name)
+
+		result.Result, err = waitForJob(ctx, ch, op, name)
+		if err != nil {
+			return result, err
+		}
+		c.unitLog(name, op).WithFields(log.Fields{"job": jobID, "result": result.Result}).Info("command completed")
+
+		// A skipped job, or a start with unmet conditions on older systemd versions, does not
+		// activate the unit
+		conditions, err := c.unitConditions(ctx, targetUnit.Name)
+		if err != nil {
+			return result, err
+		}
+		if !conditions.ConditionResult {
+			result.Conditions = conditions
+			c.unitLog(name, op).WithField("conditions", conditions.Failed).Info("unit not activated, conditions not met")
+			continue
+		}
+		if result.Result == "skipped" || (onlyIfRunning && targetUnit.ActiveState != "active") {
+			continue
+		}
+
+		// The job only confirms systemd accepted the (re)start; verify the unit actually came up
+		err = c.waitUnitStarted(ctx, targetUnit.Name, c.startTimeout)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// checkUnitLoaded returns the unit's LoadError if its file could not be loaded, instead of
+// the opaque error systemd returns when starting such a unit.
+func (c *SystemdController) checkUnitLoaded(ctx context.Context, unit dbus.UnitStatus) error {
+	if unit.LoadState == "loaded" {
+		return nil
+	}
+	prop, err := c.dbusConn().GetUnitPropertyContext(ctx, unit.Name, "LoadError")
+	if err != nil {
+		return fmt.Errorf("unit %s is %s", unit.Name, unit.LoadState)
+	}
+	message := loadErrorMessage(prop.Value.Value())
+	if message == "" {
+		return fmt.Errorf("unit %s is %s", unit.Name, unit.LoadState)
+	}
+	return fmt.Errorf("unit %s failed to load: %s", unit.Name, message)
+}
+
+// WaitForUnitState blocks until the unit's ActiveState equals target, the context is cancelled, or the timeout elapses.
+func (c *SystemdController) WaitForUnitState(ctx context.Context, name string, target string, timeout time.Duration) error {
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+	if target == "" {
+		return fmt.Errorf("incorrect input, must be target state")
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("incorrect input, timeout must be positive")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return err
+	}
+
+	// Wait for unit(s)
+	for _, targetUnit := range units {
+		err := c.waitUnitState(ctx, targetUnit.Name, target, timeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WaitForUnitsActive blocks until all units are active, e.g. as a readiness barrier. The units
+// are polled together, so the timeout applies to the whole set. A unit entering 'failed' returns
+// an error immediately; on timeout, the error names the units that are not active yet.
+func (c *SystemdController) WaitForUnitsActive(ctx context.Context, names []string, timeout time.Duration) error {
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("incorrect input, must be unit name")
+		}
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("incorrect input, timeout must be positive")
+	}
+
+	// Find unit(s)
+	var pending []string
+	for _, name := range names {
+		units, err := c.findUnit(name, lookupRead)
+		if err != nil {
+			return err
+		}
+		for _, unit := range units {
+			if !slices.Contains(pending, unit.Name) {
+				pending = append(pending, unit.Name)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(unitStatePollInterval)
+	defer ticker.Stop()
+
+	// Wait for unit(s); the states of all pending units are read in one call
+	for len(pending) > 0 {
+		units, err := c.dbusConn().ListUnitsByNamesContext(ctx, pending)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("units %s did not become active within %s: %v", strings.Join(pending, ", "), timeout, ctx.Err())
+			}
+			return fmt.Errorf("cannot get state of units %s: %v", strings.Join(pending, ", "), err)
+		}
+		var stillPending []string
+		for _, unit := range units {
+			switch unit.ActiveState {
+			case "active":
+			case "failed":
+				return fmt.Errorf("unit %s failed while waiting for active: %s (%s)", unit.Name, unit.ActiveState, unit.SubState)
+			default:
+				stillPending = append(stillPending, unit.Name)
+			}
+		}
+		pending = stillPending
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("units %s did not become active within %s", strings.Join(pending, ", "), timeout)
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// waitUnitStarted polls the unit after its start job completed until it is up and stayed up for
+// unitSettleTime, to catch processes that crash right after starting. Services are up once
+// 'active (running)', or 'active (exited)' with RemainAfterExit. A oneshot service without
+// RemainAfterExit is 'inactive (dead)' after a successful run, which is reported as success as
+// well; other unit types only need to be active. If the timeout elapses while the unit is up,
+// the remaining settle time is skipped.
+func (c *SystemdController) waitUnitStarted(ctx context.Context, name string, timeout time.Duration) error {
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Get service type; the start job of a oneshot only completes once its process exited
+	isService := strings.HasSuffix(name, ".service")
+	var serviceType string
+	var remainAfterExit bool
+	if isService {
+		props, err := c.dbusConn().GetUnitTypePropertiesContext(ctx, name, "Service")
+		if err != nil {
+			return fmt.Errorf("cannot get service type of unit %s: %v", name, err)
+		}
+		serviceType, _ = props["Type"].(string)
+		remainAfterExit, _ = props["RemainAfterExit"].(bool)
+	}
+
+	ticker := time.NewTicker(unitStatePollInterval)
+	defer ticker.Stop()
+
+	var upSince time.Time
+	for {
+		props, err := c.dbusConn().GetUnitPropertiesContext(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				if !upSince.IsZero() {
+					return nil
+				}
+				return fmt.Errorf("unit %s did not become active within %s: %v", name, timeout, ctx.Err())
+			}
+			return fmt.Errorf("cannot get state of unit %s: %v", name, err)
+		}
+		activeState, _ := props["ActiveState"].(string)
+		subState, _ := props["SubState"].(string)
+
+		up := activeState == "active"
+		switch {
+		case activeState == "failed":
+			return fmt.Errorf("unit %s failed while waiting for active: %s (%s)", name, activeState, subState)
+		case serviceType == "oneshot" && activeState == "inactive":
+			return c.checkServiceResult(ctx, name)
+		case serviceType == "oneshot":
+		case isService && up && subState != "running" && !(remainAfterExit && subState == "exited"):
+			up = false
+		case isService && activeState == "inactive":
+			return fmt.Errorf("unit %s stopped while waiting for active: %s (%s)", name, activeState, subState)
+		}
+
+		if !up {
+			upSince = time.Time{}
+		} else if upSince.IsZero() {
+			upSince = time.Now()
+		}
+		if up && (serviceType == "oneshot" || time.Since(upSince) >= unitSettleTime) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if up {
+				return nil
+			}
+			return fmt.Errorf("unit %s did not become active within %s: %s (%s)", name, timeout, activeState, subState)
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkServiceResult returns an error unless the service's last run succeeded.
+func (c *SystemdController) checkServiceResult(ctx context.Context, name string) error {
+	prop, err := c.dbusConn().GetServicePropertyContext(ctx, name, "Result")
+	if err != nil {
+		return fmt.Errorf("cannot get result of unit %s: %v", name, err)
+	}
+	result, _ := prop.Value.Value().(string)
+	if result != "success" {
+		return fmt.Errorf("unit %s did not run successfully: %s", name, result)
+	}
+	return nil
+}
+
+// waitUnitState polls the unit until its ActiveState equals target. A unit entering 'failed' while
+// waiting for another state returns an error immediately.
+// go-systemd's unit subscription runs an unstoppable goroutine per call, hence polling here.
+func (c *SystemdController) waitUnitState(ctx context.Context, name string, target string, timeout time.Duration) error {
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(unitStatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		props, err := c.dbusConn().GetUnitPropertiesContext(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("unit %s did not become %s within %s: %v", name, target, timeout, ctx.Err())
+			}
+			return fmt.Errorf("cannot get state of unit %s: %v", name, err)
+		}
+		activeState, _ := props["ActiveState"].(string)
+		subState, _ := props["SubState"].(string)
+
+		if activeState == target {
+			return nil
+		}
+		if activeState == "failed" {
+			return fmt.Errorf("unit %s failed while waiting for %s: %s (%s)", name, target, activeState, subState)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("unit %s did not become %s within %s: %s (%s)", name, target, timeout, activeState, subState)
+		case <-ticker.C:
+		}
+	}
+}
+
+// UnitStateChange describes a state transition of a watched unit.
+type UnitStateChange struct {
+	Name           string
+	OldActiveState string
+	ActiveState    string
+	OldSubState    string
+	SubState       string
+}
+
+// WatchUnit emits a UnitStateChange on every ActiveState or SubState transition of the unit, polled
+// at the interval set by WithWatchInterval. The channel is closed when the context is done or the
+// controller is closed.
+func (c *SystemdController) WatchUnit(ctx context.Context, name string) (<-chan UnitStateChange, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupState)
+	if err != nil {
+		return nil, err
+	}
+	last := units[0]
+
+	changes := make(chan UnitStateChange)
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(c.watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			case <-ticker.C:
+			}
+
+			units, err := c.dbusConn().ListUnitsByNamesContext(ctx, []string{last.Name})
+			if err != nil || len(units) < 1 {
+				if ctx.Err() == nil {
+					c.unitLog(last.Name, "watch").WithError(err).Info("cannot fetch state of watched unit")
+				}
+				continue
+			}
+			current := units[0]
+			if current.ActiveState == last.ActiveState && current.SubState == last.SubState {
+				continue
+			}
+
+			change := UnitStateChange{
+				Name:           current.Name,
+				OldActiveState: last.ActiveState,
+				ActiveState:    current.ActiveState,
+				OldSubState:    last.SubState,
+				SubState:       current.SubState,
+			}
+			last = current
+
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+func (c *SystemdController) StopUnit(ctx context.Context, name string) (*JobResult, error) {
+	return c.StopUnitWithMode(ctx, name, "replace")
+}
+
+// StopUnitWithMode stops the unit with the given systemd job mode, e.g. 'fail' to reject
+// a stop that conflicts with queued jobs.
+func (c *SystemdController) StopUnitWithMode(ctx context.Context, name string, mode string) (_ *JobResult, err error) {
+	defer c.beginOp(ctx, name, "stop")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	if !slices.Contains(stopJobModes, mode) {
+		return nil, fmt.Errorf("unsupported job mode %s, must be one of %v", mode, stopJobModes)
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop unit(s)
+	var result *JobResult
+	for _, targetUnit := range units {
+
+		ch := newJobChannel()
+		var jobID int
+		err := c.withRetry(ctx, func() (err error) {
+			jobID, err = c.dbusConn().StopUnitContext(ctx, targetUnit.Name, mode, ch)
+			return err
+		})
+		if err != nil {
+			return nil, unitOpError(targetUnit.Name, err)
+		}
+		result = newJobResult(jobID, targetUnit.Name)
+
+		result.Result, err = waitForJob(ctx, ch, "stop", name)
+		if err != nil {
+			return result, err
+		}
+		c.unitLog(name, "stop").WithFields(log.Fields{"job": jobID, "result": result.Result}).Info("command completed")
+	}
+	// @TODO This only verifies the stop job; requires e.g., subscription to track stop
+
+	return result, nil
+}
+
+// StopUnitGraceful stops the unit and, if it did not stop within timeout, kills all of its
+// processes with SIGKILL. An escalation to kill is reported with an error wrapping ErrStopKilled,
+// even if the unit stopped afterwards.
+func (c *SystemdController) StopUnitGraceful(ctx context.Context, name string, timeout time.Duration) (err error) {
+	defer c.beginOp(ctx, name, "stop-graceful")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("incorrect input, timeout must be positive")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+
+	// Stop unit(s); the stop job completes once all processes exited
+	for _, targetUnit := range units {
+
+		ch := newJobChannel()
+		var jobID int
+		err := c.withRetry(ctx, func() (err error) {
+			jobID, err = c.dbusConn().StopUnitContext(ctx, targetUnit.Name, "replace", ch)
+			return err
+		})
+		if err != nil {
+			return unitOpError(targetUnit.Name, err)
+		}
+
+		stopCtx, cancel := context.WithTimeout(ctx, timeout)
+		status, err := waitForJob(stopCtx, ch, "stop", targetUnit.Name)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if status != "" {
+			if err != nil {
+				return err
+			}
+			c.unitLog(targetUnit.Name, "stop").WithFields(log.Fields{"job": jobID, "result": status}).Info("command completed")
+			continue
+		}
+
+		// Escalate to kill
+		c.unitLog(targetUnit.Name, "stop").WithField("timeout", timeout).Info("unit did not stop in time, killing it")
+		err = c.KillUnit(ctx, targetUnit.Name)
+		if err != nil {
+			return fmt.Errorf("%w: unit %s did not stop within %s and kill failed: %w", ErrStopKilled, targetUnit.Name, timeout, err)
+		}
+		_, err = waitForJob(ctx, ch, "stop", targetUnit.Name)
+		if err != nil {
+			return fmt.Errorf("%w: unit %s did not stop within %s: %w", ErrStopKilled, targetUnit.Name, timeout, err)
+		}
+		return fmt.Errorf("%w: unit %s did not stop within %s", ErrStopKilled, targetUnit.Name, timeout)
+	}
+
+	return nil
+}
+
+func (c *SystemdController) KillUnit(ctx context.Context, name string) error {
+	return c.SignalUnit(ctx, name, syscall.SIGKILL)
+}
+
+// SignalUnit sends the signal to all processes of the unit.
+func (c *SystemdController) SignalUnit(ctx context.Context, name string, signal syscall.Signal) error {
+	return c.SignalUnitTarget(ctx, name, dbus.All, signal)
+}
+
+// SignalUnitTarget sends the signal to the unit's main process, control process, or all of its processes.
+func (c *SystemdController) SignalUnitTarget(ctx context.Context, name string, who dbus.Who, signal syscall.Signal) (err error) {
+	defer c.beginOp(ctx, name, "kill")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+	switch who {
+	case dbus.All, dbus.Main, dbus.Control:
+	default:
+		return fmt.Errorf("incorrect input, unknown signal target %s", who)
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+
+	// Signal unit(s); KillUnitContext discards the dbus error, so use the targeted variant
+	var errs []error
+	for _, targetUnit := range units {
+		err := c.dbusConn().KillUnitWithTarget(ctx, targetUnit.Name, who, int32(signal))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to send %s to unit %s: %w", signal, targetUnit.Name, unitOpError(targetUnit.Name, err)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// UnitFileChange describes a symlink created or removed by a unit file operation.
+type UnitFileChange struct {
+	Type        string
+	Filename    string
+	Destination string
+}
+
+// UnitFileResult reports the changes of a unit file operation. No changes means the unit file
+// was already in the requested state; otherwise a daemon reload is needed to pick them up.
+type UnitFileResult struct {
+	Changes        []UnitFileChange
+	ReloadRequired bool
+}
+
+func newUnitFileResult(changes []UnitFileChange) *UnitFileResult {
+	return &UnitFileResult{
+		Changes:        changes,
+		ReloadRequired: len(changes) > 0,
+	}
+}
+
+// EnableUnit enables the unit file so the unit is started on boot.
+func (c *SystemdController) EnableUnit(ctx context.Context, name string) (_ *UnitFileResult, err error) {
+	defer c.beginOp(ctx, name, "enable")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	_, err = c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enable unit file
+	hasInstallInfo, enableChanges, err := c.dbusConn().EnableUnitFilesContext(ctx, []string{name}, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable unit %s: %w", name, unitOpError(name, err))
+	}
+	if !hasInstallInfo {
+		c.unitLog(name, "enable").Info("unit has no install information, enabling has no effect")
+	}
+
+	var changes []UnitFileChange
+	for _, change := range enableChanges {
+		changes = append(changes, UnitFileChange(change))
+	}
+
+	return newUnitFileResult(changes), nil
+}
+
+// DisableUnit disables the unit file so the unit is no longer started on boot.
+func (c *SystemdController) DisableUnit(ctx context.Context, name string) (_ *UnitFileResult, err error) {
+	defer c.beginOp(ctx, name, "disable")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	_, err = c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Disable unit file
+	disableChanges, err := c.dbusConn().DisableUnitFilesContext(ctx, []string{name}, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to disable unit %s: %w", name, unitOpError(name, err))
+	}
+
+	var changes []UnitFileChange
+	for _, change := range disableChanges {
+		changes = append(changes, UnitFileChange(change))
+	}
+
+	return newUnitFileResult(changes), nil
+}
+
+// MaskUnit links the unit file to /dev/null so the unit cannot be started at all, not even as a
+// dependency. With runtime, the mask is placed in /run and lost on reboot.
+func (c *SystemdController) MaskUnit(ctx context.Context, name string, runtime bool) (_ *UnitFileResult, err error) {
+	defer c.beginOp(ctx, name, "mask")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	_, err = c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mask unit file
+	maskChanges, err := c.dbusConn().MaskUnitFilesContext(ctx, []string{name}, runtime, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mask unit %s: %w", name, unitOpError(name, err))
+	}
+
+	var changes []UnitFileChange
+	for _, change := range maskChanges {
+		changes = append(changes, UnitFileChange(change))
+	}
+
+	return newUnitFileResult(changes), nil
+}
+
+// UnmaskUnit removes the unit's mask created by MaskUnit with the same runtime setting.
+func (c *SystemdController) UnmaskUnit(ctx context.Context, name string, runtime bool) (_ *UnitFileResult, err error) {
+	defer c.beginOp(ctx, name, "unmask")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	_, err = c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmask unit file
+	unmaskChanges, err := c.dbusConn().UnmaskUnitFilesContext(ctx, []string{name}, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmask unit %s: %w", name, unitOpError(name, err))
+	}
+
+	var changes []UnitFileChange
+	for _, change := range unmaskChanges {
+		changes = append(changes, UnitFileChange(change))
+	}
+
+	return newUnitFileResult(changes), nil
+}
+
+// GetSystemState returns the manager's overall state, e.g. 'running', or 'degraded' if any unit failed.
+func (c *SystemdController) GetSystemState(ctx context.Context) (string, error) {
+
+	// Input validation
+	if ctx == nil {
+		return "", fmt.Errorf("context cannot be nil")
+	}
+	if !c.IsConnected() {
+		return "", ErrNotConnected
+	}
+
+	// Get manager property; go-systemd returns it in GVariant text format, i.e., quoted
+	value, err := c.dbusConn().GetManagerProperty("SystemState")
+	if err != nil {
+		return "", fmt.Errorf("cannot get system state: %v", err)
+	}
+	return strings.Trim(value, "'\""), nil
+}
+
+// DaemonReload reloads all unit files, e.g. after EnableUnit or after new unit files were installed.
+// The dbus error is returned as is, so callers can decide whether to retry.
+func (c *SystemdController) DaemonReload(ctx context.Context) (err error) {
+	defer c.beginOp(ctx, "", "daemon-reload")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+
+	// Unit files may have changed
+	defer c.invalidateUnit("")
+	return c.dbusConn().ReloadContext(ctx)
+}
+
+// ResetFailedUnit clears the failed state of the unit, which allows reusing the name of a
+// crashed transient unit.
+func (c *SystemdController) ResetFailedUnit(ctx context.Context, name string) (err error) {
+	defer c.beginOp(ctx, name, "reset-failed")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+
+	// Reset unit(s)
+	for _, targetUnit := range units {
+		err := c.dbusConn().ResetFailedUnitContext(ctx, targetUnit.Name)
+		if err != nil {
+			return fmt.Errorf("failed to reset unit %s: %w", targetUnit.Name, unitOpError(targetUnit.Name, err))
+		}
+	}
+
+	return nil
+}
+
+func (c *SystemdController) FreezeUnit(ctx context.Context, name string) (err error) {
+	defer c.beginOp(ctx, name, "freeze")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+
+	// Freeze unit(s)
+	for _, targetUnit := range units {
+		err := c.checkCanFreeze(ctx, targetUnit.Name)
+		if err != nil {
+			return err
+		}
+		err = c.dbusConn().FreezeUnit(ctx, targetUnit.Name)
+		if err != nil {
+			return unitOpError(targetUnit.Name, err)
+		}
+
+		// Freezing is asynchronous, wait until the cgroup is actually frozen
+		err = c.waitFreezerState(ctx, targetUnit.Name, "frozen")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *SystemdController) UnfreezeUnit(ctx context.Context, name string) (err error) {
+	defer c.beginOp(ctx, name, "unfreeze")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+
+	// Thaw unit(s)
+	for _, targetUnit := range units {
+		err := c.checkCanFreeze(ctx, targetUnit.Name)
+		if err != nil {
+			return err
+		}
+		err = c.dbusConn().ThawUnit(ctx, targetUnit.Name)
+		if err != nil {
+			return unitOpError(targetUnit.Name, err)
+		}
+
+		// Thawing is asynchronous, wait until the cgroup is running again
+		err = c.waitFreezerState(ctx, targetUnit.Name, "running")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FreezeUnits freezes a batch of units. All freeze requests are issued before waiting for the
+// units to reach the 'frozen' FreezerState, so the units are paused at about the same time. The
+// result holds an entry for every unit, nil on success; the error is only set for invalid input.
+func (c *SystemdController) FreezeUnits(ctx context.Context, names []string) (map[string]error, error) {
+	return c.freezeUnits(ctx, names, "freeze", systemdConn.FreezeUnit, "frozen")
+}
+
+// UnfreezeUnits thaws a batch of units like FreezeUnits, waiting for the 'running' FreezerState.
+func (c *SystemdController) UnfreezeUnits(ctx context.Context, names []string) (map[string]error, error) {
+	return c.freezeUnits(ctx, names, "unfreeze", systemdConn.ThawUnit, "running")
+}
+
+func (c *SystemdController) freezeUnits(ctx context.Context, names []string, op string, action freezerFunc, target string) (map[string]error, error) {
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("incorrect input, must be unit name")
+		}
+	}
+
+	// Request freezer state change of all unit(s)
+	results := make(map[string]error, len(names))
+	requested := make(map[string][]string, len(names))
+	done := make(map[string]func(*error), len(names))
+	for _, name := range names {
+		if _, ok := done[name]; ok {
+			continue
+		}
+		done[name] = c.beginOp(ctx, name, op)
+		requested[name], results[name] = c.requestFreezerState(ctx, name, action)
+	}
+
+	// Wait for unit(s); the changes proceed concurrently, so the waits overlap
+	for _, name := range names {
+		if results[name] == nil {
+			for _, unit := range requested[name] {
+				err := c.waitFreezerState(ctx, unit, target)
+				if err != nil {
+					results[name] = err
+					break
+				}
+			}
+		}
+		if finish, ok := done[name]; ok {
+			err := results[name]
+			finish(&err)
+			delete(done, name)
+		}
+	}
+
+	return results, nil
+}
+
+// requestFreezerState applies the freeze or thaw action to the unit(s) matching name without
+// waiting, and returns the affected unit names.
+func (c *SystemdController) requestFreezerState(ctx context.Context, name string, action freezerFunc) ([]string, error) {
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return nil, err
+	}
+
+	var requested []string
+	for _, targetUnit := range units {
+		err := c.checkCanFreeze(ctx, targetUnit.Name)
+		if err != nil {
+			return nil, err
+		}
+		err = action(c.dbusConn(), ctx, targetUnit.Name)
+		if err != nil {
+			return nil, unitOpError(targetUnit.Name, err)
+		}
+		requested = append(requested, targetUnit.Name)
+	}
+
+	return requested, nil
+}
+
+// checkCanFreeze returns an error if the unit type does not support freezing, e.g. sockets.
+func (c *SystemdController) checkCanFreeze(ctx context.Context, name string) error {
+	prop, err := c.dbusConn().GetUnitPropertyContext(ctx, name, "CanFreeze")
+	if err != nil {
+		return fmt.Errorf("cannot get freezer support of unit %s: %v", name, err)
+	}
+	canFreeze, ok := prop.Value.Value().(bool)
+	if !ok || !canFreeze {
+		return fmt.Errorf("unit %s does not support freezing", name)
+	}
+	return nil
+}
+
+// waitFreezerState polls the unit's FreezerState until it equals target or FreezeTimeout elapses.
+func (c *SystemdController) waitFreezerState(ctx context.Context, name string, target string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, FreezeTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(unitStatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		prop, err := c.dbusConn().GetUnitPropertyContext(ctx, name, "FreezerState")
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("unit %s did not become %s within %s: %v", name, target, FreezeTimeout, ctx.Err())
+			}
+			return fmt.Errorf("cannot get freezer state of unit %s: %v", name, err)
+		}
+		state, _ := prop.Value.Value().(string)
+		if state == target {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("unit %s did not become %s within %s: %s", name, target, FreezeTimeout, state)
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessStats holds resource usage of a single process.
+type ProcessStats struct {
+	CPUPercent    float64
+	MemoryPercent float32
+	// Cumulative bytes read from and written to storage
+	ReadBytes  uint64
+	WriteBytes uint64
+	NumFDs     int32
+	// False if the process exited before or while sampling; all statistics are zero then
+	Running bool
+}
+
+// GetUnitCpuAndMem returns the resource usage of the process, usually a unit's MainPID. A process
+// that no longer exists is not an error, but reported with zeroed statistics.
+func (c *SystemdController) GetUnitCpuAndMem(ctx context.Context, pid uint32) (*ProcessStats, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	err := c.checkLocalHost("read process statistics")
+	if err != nil {
+		return nil, err
+	}
+
+	// Get process information for the service PID
+	p, err := process.NewProcessWithContext(ctx, int32(pid))
+	if isProcessGone(err) {
+		return &ProcessStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get process information for PID %d: %w", pid, err)
+	}
+
+	// Get CPU usage percentage; sampled over an interval as a fresh process has no prior measurement
+	cpuPercent, err := p.PercentWithContext(ctx, cpuSampleInterval)
+	if isProcessGone(err) {
+		return &ProcessStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get CPU usage for PID %d: %w", pid, err)
+	}
+
+	// Get memory usage statistics
+	memInfo, err := p.MemoryPercentWithContext(ctx)
+	if isProcessGone(err) {
+		return &ProcessStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get memory usage for PID %d: %w", pid, err)
+	}
+
+	// Get disk IO and file descriptor counters
+	ioCounters, err := p.IOCountersWithContext(ctx)
+	if isProcessGone(err) {
+		return &ProcessStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get IO counters for PID %d: %w", pid, err)
+	}
+	numFDs, err := p.NumFDsWithContext(ctx)
+	if isProcessGone(err) {
+		return &ProcessStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get file descriptors for PID %d: %w", pid, err)
+	}
+
+	return &ProcessStats{
+		CPUPercent:    cpuPercent,
+		MemoryPercent: memInfo,
+		ReadBytes:     ioCounters.ReadBytes,
+		WriteBytes:    ioCounters.WriteBytes,
+		NumFDs:        numFDs,
+		Running:       true,
+	}, nil
+}
+
+// isProcessGone reports whether the gopsutil error is caused by the process having exited, as
+// opposed to e.g. missing permissions.
+func isProcessGone(err error) bool {
+	return errors.Is(err, process.ErrorProcessNotRunning) || errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ESRCH)
+}
+
+// GetUnitCpuAndMemByName returns the process statistics of the service's current main process.
+func (c *SystemdController) GetUnitCpuAndMemByName(ctx context.Context, name string) (*ProcessStats, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	err := c.checkLocalHost("read process statistics")
+	if err != nil {
+		return nil, err
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get main PID; it is 0 while the service is not running
+	prop, err := c.dbusConn().GetServicePropertyContext(ctx, units[0].Name, "MainPID")
+	if err != nil {
+		return nil, fmt.Errorf("cannot get main PID of unit %s: %v", name, err)
+	}
+	pid, _ := prop.Value.Value().(uint32)
+	if pid == 0 {
+		return nil, fmt.Errorf("%w: %s has no main process", ErrUnitNotRunning, name)
+	}
+
+	return c.GetUnitCpuAndMem(ctx, pid)
+}
+
+// ResourceLimits are runtime cgroup limits of a unit; nil fields are left unchanged.
+type ResourceLimits struct {
+	// CPU time relative to one CPU, e.g. 200 allows two full CPUs
+	CPUQuotaPercent *float64
+	// Memory limit in bytes
+	MemoryMax *uint64
+	// Maximum number of tasks (processes and threads)
+	TasksMax *uint64
+}
+
+// SetUnitResourceLimits applies the limits to the running unit. The limits are not persisted
+// and are lost on reboot.
+func (c *SystemdController) SetUnitResourceLimits(ctx context.Context, name string, limits ResourceLimits) (err error) {
+	defer c.beginOp(ctx, name, "set-resource-limits")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Translate limits
+	var props []dbus.Property
+	if limits.CPUQuotaPercent != nil {
+		if !(*limits.CPUQuotaPercent > 0) || math.IsInf(*limits.CPUQuotaPercent, 1) {
+			return fmt.Errorf("incorrect input, CPU quota must be positive")
+		}
+		// CPUQuota=1% corresponds to 10ms CPU time per second
+		quota := uint64(*limits.CPUQuotaPercent * 10000)
+		props = append(props, dbus.Property{Name: "CPUQuotaPerSecUSec", Value: dbus_direct.MakeVariant(quota)})
+	}
+	if limits.MemoryMax != nil {
+		if *limits.MemoryMax == 0 {
+			return fmt.Errorf("incorrect input, memory limit must be positive")
+		}
+		props = append(props, dbus.Property{Name: "MemoryMax", Value: dbus_direct.MakeVariant(*limits.MemoryMax)})
+	}
+	if limits.TasksMax != nil {
+		if *limits.TasksMax == 0 {
+			return fmt.Errorf("incorrect input, task limit must be positive")
+		}
+		props = append(props, dbus.Property{Name: "TasksMax", Value: dbus_direct.MakeVariant(*limits.TasksMax)})
+	}
+	if len(props) < 1 {
+		return fmt.Errorf("incorrect input, no limits given")
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+
+	// Set limits at runtime
+	for _, targetUnit := range units {
+		err := c.dbusConn().SetUnitPropertiesContext(ctx, targetUnit.Name, true, props...)
+		if err != nil {
+			return fmt.Errorf("failed to set resource limits of unit %s: %w", targetUnit.Name, unitOpError(targetUnit.Name, err))
+		}
+	}
+
+	return nil
+}
+
+// settableProperties maps the properties supported by SetUnitProperties to their dbus signature.
+var settableProperties = map[string]string{
+	"CPUWeight":          "t",
+	"StartupCPUWeight":   "t",
+	"CPUQuotaPerSecUSec": "t",
+	"IOWeight":           "t",
+	"StartupIOWeight":    "t",
+	"MemoryMin":          "t",
+	"MemoryLow":          "t",
+	"MemoryHigh":         "t",
+	"MemoryMax":          "t",
+	"MemorySwapMax":      "t",
+	"TasksMax":           "t",
+	"CPUAccounting":      "b",
+	"IOAccounting":       "b",
+	"MemoryAccounting":   "b",
+	"TasksAccounting":    "b",
+	"IPAccounting":       "b",
+	"Nice":               "i",
+	"Description":        "s",
+	"Environment":        "as",
+}
+
+// SetUnitProperties sets the given properties of the unit, either at runtime only or persistently.
+// Supported are the cgroup weights and limits CPUWeight, StartupCPUWeight, CPUQuotaPerSecUSec,
+// IOWeight, StartupIOWeight, MemoryMin, MemoryLow, MemoryHigh, MemoryMax, MemorySwapMax, and
+// TasksMax, the CPU, IO, memory, tasks, and IP accounting switches, Nice, Description, and
+// Environment as 'KEY=value' strings.
+// Values may be any Go integer type for numeric properties; systemd may still reject
+// properties it cannot change on a running unit.
+func (c *SystemdController) SetUnitProperties(ctx context.Context, name string, props map[string]interface{}, runtime bool) (err error) {
+	defer c.beginOp(ctx, name, "set-properties")(&err)
+	defer c.trackOp()()
+
+	// Input validation
+	if ctx == nil {
+		return fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return fmt.Errorf("incorrect input, must be unit name")
+	}
+	if len(props) < 1 {
+		return fmt.Errorf("incorrect input, no properties given")
+	}
+
+	// Translate properties
+	var errs []error
+	var dbusProps []dbus.Property
+	for propName, value := range props {
+		prop, err := unitProperty(propName, value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		dbusProps = append(dbusProps, prop)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("incorrect input: %w", errors.Join(errs...))
+	}
+
+	// Find unit(s)
+	units, err := c.findUnit(name, lookupLive)
+	if err != nil {
+		return err
+	}
+
+	// Set properties
+	for _, targetUnit := range units {
+		err := c.dbusConn().SetUnitPropertiesContext(ctx, targetUnit.Name, runtime, dbusProps...)
+		if err != nil {
+			return fmt.Errorf("failed to set properties of unit %s: %w", targetUnit.Name, unitOpError(targetUnit.Name, err))
+		}
+	}
+
+	return nil
+}
+
+// UnitAccounting reports which resource accounting is enabled for a unit. Without accounting, systemd
+// does not report the corresponding usage, e.g. in GetUnitResourceUsage.
+type UnitAccounting struct {
+	CPU    bool
+	Memory bool
+	IO     bool
+	Tasks  bool
+}
+
+// GetUnitAccounting returns the resource accounting settings of the unit.
+func (c *SystemdController) GetUnitAccounting(ctx context.Context, name string) (*UnitAccounting, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get unit properties; the accounting switches belong to the unit type interface
+	props, err := c.dbusConn().GetAllPropertiesContext(ctx, units[0].Name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get accounting of unit %s: %v", name, err)
+	}
+
+	accounting := &UnitAccounting{}
+	accounting.CPU, _ = props["CPUAccounting"].(bool)
+	accounting.Memory, _ = props["MemoryAccounting"].(bool)
+	accounting.IO, _ = props["IOAccounting"].(bool)
+	accounting.Tasks, _ = props["TasksAccounting"].(bool)
+
+	return accounting, nil
+}
+
+// EnableUnitAccounting enables CPU and memory accounting of the unit, either at runtime only or
+// persistently, so systemd reports authoritative usage of its control group.
+func (c *SystemdController) EnableUnitAccounting(ctx context.Context, name string, runtime bool) error {
+	return c.SetUnitProperties(ctx, name, map[string]interface{}{
+		"CPUAccounting":    true,
+		"MemoryAccounting": true,
+	}, runtime)
+}
+
+// GetUnitEnvironment returns the environment variables the service is configured with as
+// 'KEY=value' strings, excluding variables from EnvironmentFile and the manager environment.
+func (c *SystemdController) GetUnitEnvironment(ctx context.Context, name string) ([]string, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	if !strings.HasSuffix(name, ".service") {
+		return nil, fmt.Errorf("%w: unit %s is not a service", ErrUnitType, name)
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get service environment
+	prop, err := c.dbusConn().GetServicePropertyContext(ctx, units[0].Name, "Environment")
+	if err != nil {
+		return nil, fmt.Errorf("cannot get environment of unit %s: %v", name, err)
+	}
+	env, _ := prop.Value.Value().([]string)
+
+	return env, nil
+}
+
+// SetUnitEnvironment sets the environment variables of the service, effective on its next
+// (re)start. systemd only accepts this for units created at runtime, e.g. applications.
+func (c *SystemdController) SetUnitEnvironment(ctx context.Context, name string, env map[string]string, runtime bool) error {
+
+	// Input validation
+	var entries []string
+	for key, value := range env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid environment variable name %q", key)
+		}
+		entries = append(entries, key+"="+value)
+	}
+	slices.Sort(entries)
+
+	return c.SetUnitProperties(ctx, name, map[string]interface{}{"Environment": entries}, runtime)
+}
+
+// unitProperty converts the value to the dbus type of the settable property.
+func unitProperty(name string, value interface{}) (dbus.Property, error) {
+
+	signature, ok := settableProperties[name]
+	if !ok {
+		return dbus.Property{}, fmt.Errorf("property %s not supported", name)
+	}
+
+	var variant interface{}
+	switch signature {
+	case "t":
+		v, ok := toInt64(value)
+		if !ok || v < 0 {
+			return dbus.Property{}, fmt.Errorf("property %s must be a non-negative integer, got %T", name, value)
+		}
+		variant = uint64(v)
+		if u, isUint := value.(uint64); isUint {
+			variant = u
+		}
+	case "i":
+		v, ok := toInt64(value)
+		if !ok || v < math.MinInt32 || v > math.MaxInt32 {
+			return dbus.Property{}, fmt.Errorf("property %s must be a 32-bit integer, got %T", name, value)
+		}
+		variant = int32(v)
+	case "b":
+		v, ok := value.(bool)
+		if !ok {
+			return dbus.Property{}, fmt.Errorf("property %s must be a bool, got %T", name, value)
+		}
+		variant = v
+	case "s":
+		v, ok := value.(string)
+		if !ok {
+			return dbus.Property{}, fmt.Errorf("property %s must be a string, got %T", name, value)
+		}
+		variant = v
+	case "as":
+		v, ok := value.([]string)
+		if !ok {
+			return dbus.Property{}, fmt.Errorf("property %s must be a string slice, got %T", name, value)
+		}
+		variant = v
+	}
+
+	return dbus.Property{Name: name, Value: dbus_direct.MakeVariant(variant)}, nil
+}
+
+// toInt64 converts any Go integer type; a uint64 beyond MaxInt64 is reported as MaxInt64.
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(min(uint64(v), math.MaxInt64)), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(min(v, math.MaxInt64)), true
+	}
+	return 0, false
+}
+
+// GetUnitPIDs returns the PIDs of all processes in the unit's control group. A unit without
+// control group, e.g. one that is not running, has no processes.
+func (c *SystemdController) GetUnitPIDs(ctx context.Context, name string) ([]uint32, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	err := c.checkLocalHost("read control group processes")
+	if err != nil {
+		return nil, err
+	}
+
+	// Find unit
+	_, err = c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get control group
+	cgroup, err := c.unitCgroup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if cgroup == "" {
+		return nil, nil
+	}
+
+	// Read control group members
+	pids, err := util.GetCGroupProcs(cgroup)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read processes of unit %s: %v", name, err)
+	}
+
+	return pids, nil
+}
+
+// GetUnitCgroup returns the unit's control group path, e.g. '/system.slice/foo.service'. It is
+// empty for units without control group, e.g. targets or units that are not running.
+func (c *SystemdController) GetUnitCgroup(ctx context.Context, name string) (string, error) {
+
+	// Input validation
+	if ctx == nil {
+		return "", fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return "", fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return "", err
+	}
+
+	cgroup, err := c.unitCgroup(ctx, units[0].Name)
+	if err != nil {
+		return "", fmt.Errorf("cannot get control group of unit %s: %v", name, err)
+	}
+	return cgroup, nil
+}
+
+// unitCgroup returns the unit's ControlGroup property, which is empty if the unit has no cgroup.
+func (c *SystemdController) unitCgroup(ctx context.Context, name string) (string, error) {
+	props, err := c.dbusConn().GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	cgroup, _ := props["ControlGroup"].(string)
+	return cgroup, nil
+}
+
+// UnitResourceUsage holds the cgroup-wide accounting of a unit, covering all of its processes.
+type UnitResourceUsage struct {
+	// Cumulative CPU time consumed in nanoseconds
+	CPUUsageNSec uint64
+	// Current memory usage in bytes
+	MemoryCurrent uint64
+}
+
+// GetUnitResourceUsage returns the unit's cgroup accounting as reported by systemd. Unlike
+// GetUnitCpuAndMem, this includes all child processes of the unit.
+func (c *SystemdController) GetUnitResourceUsage(ctx context.Context, name string) (*UnitResourceUsage, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	_, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get unit properties, including the type-specific cgroup accounting
+	props, err := c.dbusConn().GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	cpuUsage, cpuOk := props["CPUUsageNSec"].(uint64)
+	memCurrent, memOk := props["MemoryCurrent"].(uint64)
+	if !cpuOk || !memOk {
+		return nil, fmt.Errorf("unit %s has no cgroup accounting", name)
+	}
+
+	// systemd reports UINT64_MAX if accounting is disabled for the unit
+	if cpuUsage == math.MaxUint64 || memCurrent == math.MaxUint64 {
+		return nil, fmt.Errorf("cgroup accounting not enabled for unit %s", name)
+	}
+
+	return &UnitResourceUsage{
+		CPUUsageNSec:  cpuUsage,
+		MemoryCurrent: memCurrent,
+	}, nil
+}
+
+// GetUnitProperties returns all properties of the unit.
+func (c *SystemdController) GetUnitProperties(ctx context.Context, unitName string) (map[string]interface{}, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if unitName == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	units, err := c.findUnit(unitName, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get unit properties
+	props, err := c.dbusConn().GetAllPropertiesContext(ctx, units[0].Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return props, nil
+}
+
+// GetUnitProperty returns a single property of the unit without fetching all properties. Generic
+// unit properties are looked up first, then service properties for services, e.g. MainPID.
+func (c *SystemdController) GetUnitProperty(ctx context.Context, name string, property string) (interface{}, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	if property == "" {
+		return nil, fmt.Errorf("incorrect input, must be property name")
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.unitProperty(ctx, units[0].Name, property)
+}
+
+func (c *SystemdController) unitProperty(ctx context.Context, name string, property string) (interface{}, error) {
+	prop, err := c.dbusConn().GetUnitPropertyContext(ctx, name, property)
+	if err != nil && strings.HasSuffix(name, ".service") {
+		prop, err = c.dbusConn().GetServicePropertyContext(ctx, name, property)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get property %s of unit %s: %v", property, name, err)
+	}
+	return prop.Value.Value(), nil
+}
+
+// GetUnitsProperties returns the properties of several whitelisted units. The core properties
+// Description, LoadState, ActiveState, SubState, and Following of all units are read in a
+// single dbus call; other properties cost one call per unit and property. Without properties,
+// only the core properties are returned. Units that are not loaded are omitted.
+func (c *SystemdController) GetUnitsProperties(ctx context.Context, names []string, properties []string) (map[string]map[string]interface{}, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	for _, name := range names {
+		if !c.canRead(name) {
+			return nil, fmt.Errorf("%w: %s", ErrNotWhitelisted, name)
+		}
+		err := c.checkUnitType(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(names) < 1 {
+		return map[string]map[string]interface{}{}, nil
+	}
+	if !c.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
+	// List unit(s)
+	units, err := c.dbusConn().ListUnitsByNamesContext(ctx, names)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list units: %v", err)
+	}
+
+	// Collect properties
+	results := make(map[string]map[string]interface{}, len(units))
+	for _, unit := range units {
+		if unit.LoadState == "not-found" {
+			continue
+		}
+		core := map[string]interface{}{
+			"Description": unit.Description,
+			"LoadState":   unit.LoadState,
+			"ActiveState": unit.ActiveState,
+			"SubState":    unit.SubState,
+			"Following":   unit.Followed,
+		}
+		if len(properties) < 1 {
+			results[unit.Name] = core
+			continue
+		}
+
+		props := make(map[string]interface{}, len(properties))
+		for _, property := range properties {
+			if value, ok := core[property]; ok {
+				props[property] = value
+				continue
+			}
+			value, err := c.unitProperty(ctx, unit.Name, property)
+			if err != nil {
+				return nil, err
+			}
+			props[property] = value
+		}
+		results[unit.Name] = props
+	}
+
+	return results, nil
+}
+
+// UnitStatus is the typed subset of unit properties commonly needed by callers.
+type UnitStatus struct {
+	Name         string
+	Description  string
+	LoadState    string
+	ActiveState  string
+	SubState     string
+	MainPID      uint32
+	FragmentPath string
+	// Reason the unit file could not be loaded, e.g. a syntax error; empty if LoadState is 'loaded'
+	LoadError string
+}
+
+// GetUnitStatus returns the typed status of the unit.
+func (c *SystemdController) GetUnitStatus(ctx context.Context, name string) (*UnitStatus, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+
+	// Find unit
+	_, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get unit properties, including the type-specific MainPID
+	props, err := c.dbusConn().GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return unitStatusFromProperties(name, props), nil
 }
 
-func NewController(whitelist []string, applications map[string]string) (*SystemdController, error) {
-	var err error
-	var c SystemdController
+// UnitDeps holds the dependency and ordering relationships of a unit.
+type UnitDeps struct {
+	Requires  []string
+	Wants     []string
+	After     []string
+	Before    []string
+	Conflicts []string
+}
 
-	// Create dbus connector
-	ctx := context.Background()
-	systemMode := util.IsRoot()
-	if systemMode {
-		c.conn, err = dbus.NewSystemConnectionContext(ctx)
-	} else {
-		c.conn, err = dbus.NewUserConnectionContext(ctx)
+// GetUnitDependencies returns the unit's Requires, Wants, After, Before, and Conflicts relationships.
+func (c *SystemdController) GetUnitDependencies(ctx context.Context, name string) (*UnitDeps, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
 	}
+
+	// Find unit
+	_, err := c.findUnit(name, lookupRead)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check unit whitelist
-	c.whitelist = whitelist
-	for _, name := range c.whitelist {
-		_, err := c.FindUnit(name)
-		if err != nil {
-			c.conn.Close()
-			return nil, err
-		}
+	// Get unit properties
+	props, err := c.dbusConn().GetUnitPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
 	}
-	c.applications = applications
 
-	return &c, nil
-}
+	deps := &UnitDeps{}
+	deps.Requires, _ = props["Requires"].([]string)
+	deps.Wants, _ = props["Wants"].([]string)
+	deps.After, _ = props["After"].([]string)
+	deps.Before, _ = props["Before"].([]string)
+	deps.Conflicts, _ = props["Conflicts"].([]string)
 
-func (c *SystemdController) Close() {
-	c.conn.Close()
+	return deps, nil
 }
 
-func (c *SystemdController) IsUnitWhitelisted(name string) bool {
-	for _, val := range c.whitelist {
-		if val == name {
-			return true
-		}
-	}
-	return false
+// ExecProbe is a readiness check command; the unit is healthy if it exits with status 0.
+type ExecProbe struct {
+	Command []string
+	// Timeout of the probe command, defaults to DefaultProbeTimeout
+	Timeout time.Duration
 }
 
-func (c *SystemdController) FindUnit(name string) ([]dbus.UnitStatus, error) {
+// ProbeUnit reports whether the unit is active and running and, if a probe is given, whether
+// the probe command succeeds. Errors are only returned if health could not be determined.
+func (c *SystemdController) ProbeUnit(ctx context.Context, name string, probe *ExecProbe) (bool, error) {
 
-	ok := c.IsUnitWhitelisted(name)
-	if !ok {
-		return nil, fmt.Errorf("unit is not whitelisted")
+	// Input validation
+	if ctx == nil {
+		return false, fmt.Errorf("context cannot be nil")
 	}
-
-	var err error
-	var units []dbus.UnitStatus
-	units, err = c.conn.ListUnitsByNamesContext(context.Background(), []string{name})
-	if err != nil {
-		return nil, fmt.Errorf("cannot find unit with name %s: %v", name, err)
+	if name == "" {
+		return false, fmt.Errorf("incorrect input, must be unit name")
 	}
-	if len(units) < 1 {
-		return nil, fmt.Errorf("no units found with name %s", name)
+	if probe != nil && len(probe.Command) < 1 {
+		return false, fmt.Errorf("incorrect input, probe requires a command")
 	}
-	return units, err
-}
-
-func (c *SystemdController) FindUnitFiles(name string) ([]dbus.UnitFile, error) {
-
-	ok := c.IsUnitWhitelisted(name)
-	if !ok {
-		return nil, fmt.Errorf("unit is not whitelisted")
+	if probe != nil {
+		err := c.checkLocalHost("run probe")
+		if err != nil {
+			return false, err
+		}
 	}
 
-	var err error
-	units, err := c.conn.ListUnitFilesByPatternsContext(context.Background(), []string{"enabled"}, []string{name})
+	// Find unit
+	units, err := c.findUnit(name, lookupState)
 	if err != nil {
-		return nil, fmt.Errorf("cannot find unit with name %s: %v", name, err)
+		return false, err
 	}
-	if len(units) < 1 {
-		return nil, fmt.Errorf("no units found with name %s", name)
+	unit := units[0]
+	if unit.ActiveState != "active" || unit.SubState != "running" {
+		return false, nil
+	}
+	if probe == nil {
+		return true, nil
 	}
 
-	return units, err
-}
-
-func (c *SystemdController) FindUnitsByPattern(name string, states string) ([]dbus.UnitStatus, error) {
-
-	ok := c.IsUnitWhitelisted(name)
-	if !ok {
-		return nil, fmt.Errorf("unit is not whitelisted")
+	// Run probe
+	timeout := probe.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
 	}
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	var err error
-	var units []dbus.UnitStatus
-	units, err = c.conn.ListUnitsByPatternsContext(context.Background(), []string{states}, []string{name})
+	err = exec.CommandContext(probeCtx, probe.Command[0], probe.Command[1:]...).Run()
 	if err != nil {
-		return nil, fmt.Errorf("cannot find unit with name %s: %v", name, err)
-	}
-	if len(units) < 1 {
-		return nil, fmt.Errorf("no units found with name %s", name)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot run probe for unit %s: %v", name, err)
 	}
-	return units, nil
+
+	return true, nil
+}
+
+// SocketListener is an address a socket unit listens on.
+type SocketListener struct {
+	// Listener type as in the unit file without the 'Listen' prefix, e.g. 'Stream', 'Datagram', or 'FIFO'
+	Type string
+	// Socket path, address and port, or file, e.g. '/run/foo.sock' or '[::]:22'
+	Address string
 }
 
-func (c *SystemdController) StartUnit(ctx context.Context, name string) error {
+// GetSocketListeners returns the addresses the socket unit listens on.
+func (c *SystemdController) GetSocketListeners(ctx context.Context, name string) ([]SocketListener, error) {
 
 	// Input validation
 	if ctx == nil {
-		return fmt.Errorf("context cannot be nil")
+		return nil, fmt.Errorf("context cannot be nil")
 	}
 	if name == "" {
-		return fmt.Errorf("incorrect input, must be unit name")
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	if !strings.HasSuffix(name, ".socket") {
+		return nil, fmt.Errorf("%w: unit %s is not a socket", ErrUnitType, name)
 	}
 
-	// Find unit(s)
-	units, err := c.FindUnit(name)
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Restart unit(s)
-	for _, targetUnit := range units {
-
-		// (Re)start unit; 'replace' already queued jobs that may conflict
-		ch := make(chan string)
-		_, err := c.conn.RestartUnitContext(ctx, targetUnit.Name, "replace", ch)
-		if err != nil {
-			return err
-		}
+	// Get socket properties; Listen is of type a(ss), i.e., type and address
+	props, err := c.dbusConn().GetUnitTypePropertiesContext(ctx, units[0].Name, "Socket")
+	if err != nil {
+		return nil, fmt.Errorf("cannot get listeners of socket %s: %v", name, err)
+	}
+	entries, _ := props["Listen"].([][]interface{})
 
-		status := <-ch
-		switch status {
-		case "done":
-			log.Infof("unit %s (re)start cmd successful\n", name)
-		default:
-			return fmt.Errorf("failed to (re)start unit %s: %s", name, status)
+	var listeners []SocketListener
+	for _, entry := range entries {
+		if len(entry) != 2 {
+			continue
 		}
+		listenerType, _ := entry[0].(string)
+		address, _ := entry[1].(string)
+		listeners = append(listeners, SocketListener{Type: listenerType, Address: address})
 	}
-	// @TODO This only verifies the start job; requires e.g., subscription to track (re)start
 
-	return nil
+	return listeners, nil
+}
+
+// UnitRuntimeInfo holds start/exit times and the restart count of a unit. Timestamps of events
+// that never happened are zero, and NRestarts is only available for services.
+type UnitRuntimeInfo struct {
+	ActiveEnterTimestamp   time.Time
+	ExecMainStartTimestamp time.Time
+	ExecMainExitTimestamp  time.Time
+	NRestarts              uint32
+}
+
+// UnitConditions holds the result of the conditions and asserts checked at the unit's last start.
+type UnitConditions struct {
+	ConditionResult    bool
+	ConditionTimestamp time.Time
+	AssertResult       bool
+	AssertTimestamp    time.Time
+	// Failed lists the conditions and asserts not met, e.g. 'ConditionPathExists=/etc/foo'
+	Failed []string
 }
 
-func (c *SystemdController) StopUnit(ctx context.Context, name string) error {
+// GetUnitConditions returns whether the unit's conditions and asserts were met at its last start,
+// e.g. to tell why a start did not activate the unit.
+func (c *SystemdController) GetUnitConditions(ctx context.Context, name string) (*UnitConditions, error) {
 
 	// Input validation
 	if ctx == nil {
-		return fmt.Errorf("context cannot be nil")
+		return nil, fmt.Errorf("context cannot be nil")
 	}
 	if name == "" {
-		return fmt.Errorf("incorrect input, must be unit name")
+		return nil, fmt.Errorf("incorrect input, must be unit name")
 	}
 
-	// Find unit(s)
-	units, err := c.FindUnit(name)
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Stop unit(s)
-	for _, targetUnit := range units {
+	return c.unitConditions(ctx, units[0].Name)
+}
 
-		ch := make(chan string)
-		_, err := c.conn.StopUnitContext(ctx, targetUnit.Name, "replace", ch)
-		if err != nil {
-			return err
-		}
+func (c *SystemdController) unitConditions(ctx context.Context, name string) (*UnitConditions, error) {
 
-		status := <-ch
-		switch status {
-		case "done":
-			log.Infof("unit %s stop command successful\n", name)
-		default:
-			return fmt.Errorf("unit %s stop %s", name, status)
-		}
+	props, err := c.dbusConn().GetUnitPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get conditions of unit %s: %v", name, err)
 	}
-	// @TODO This only verifies the stop job; requires e.g., subscription to track stop
 
-	return nil
+	conditions := &UnitConditions{
+		ConditionTimestamp: usecTimestamp(props["ConditionTimestamp"]),
+		AssertTimestamp:    usecTimestamp(props["AssertTimestamp"]),
+	}
+	conditions.ConditionResult, _ = props["ConditionResult"].(bool)
+	conditions.AssertResult, _ = props["AssertResult"].(bool)
+	// A unit that was never started has no condition timestamp and nothing checked yet
+	if conditions.ConditionTimestamp.IsZero() {
+		conditions.ConditionResult = true
+	}
+	if conditions.AssertTimestamp.IsZero() {
+		conditions.AssertResult = true
+	}
+	conditions.Failed = append(failedConditions(props["Conditions"]), failedConditions(props["Asserts"])...)
+
+	return conditions, nil
 }
 
-func (c *SystemdController) KillUnit(ctx context.Context, name string) error {
+// failedConditions formats the checked conditions of type a(sbbsi), i.e., type, trigger, negate,
+// parameter, and state, where a negative state means the condition was not met.
+func failedConditions(value interface{}) []string {
+	var failed []string
+	entries, _ := value.([][]interface{})
+	for _, entry := range entries {
+		if len(entry) != 5 {
+			continue
+		}
+		state, _ := entry[4].(int32)
+		if state >= 0 {
+			continue
+		}
+		condType, _ := entry[0].(string)
+		negate, _ := entry[2].(bool)
+		param, _ := entry[3].(string)
+		if negate {
+			param = "!" + param
+		}
+		failed = append(failed, condType+"="+param)
+	}
+	return failed
+}
+
+// GetUnitRuntimeInfo returns when the unit was last activated, started, and exited, and how
+// often it was restarted.
+func (c *SystemdController) GetUnitRuntimeInfo(ctx context.Context, name string) (*UnitRuntimeInfo, error) {
 
 	// Input validation
 	if ctx == nil {
-		return fmt.Errorf("context cannot be nil")
+		return nil, fmt.Errorf("context cannot be nil")
 	}
 	if name == "" {
-		return fmt.Errorf("incorrect input, must be unit name")
+		return nil, fmt.Errorf("incorrect input, must be unit name")
 	}
 
-	// Find unit(s)
-	units, err := c.FindUnit(name)
+	// Find unit
+	_, err := c.findUnit(name, lookupRead)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Kill unit(s)
-	for _, targetUnit := range units {
-		c.conn.KillUnitContext(ctx, targetUnit.Name, int32(syscall.SIGKILL))
+	// Get unit properties, including the service-specific ExecMain* and NRestarts
+	props, err := c.dbusConn().GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	info := &UnitRuntimeInfo{
+		ActiveEnterTimestamp:   usecTimestamp(props["ActiveEnterTimestamp"]),
+		ExecMainStartTimestamp: usecTimestamp(props["ExecMainStartTimestamp"]),
+		ExecMainExitTimestamp:  usecTimestamp(props["ExecMainExitTimestamp"]),
+	}
+	info.NRestarts, _ = props["NRestarts"].(uint32)
+
+	return info, nil
+}
+
+// usecTimestamp converts a systemd timestamp in microseconds since epoch. Both 0 and
+// UINT64_MAX mean 'never' and yield the zero time, as do values not representable as time.Time.
+func usecTimestamp(value interface{}) time.Time {
+	usec, ok := value.(uint64)
+	if !ok || usec == 0 || usec > math.MaxInt64 {
+		return time.Time{}
+	}
+	return time.UnixMicro(int64(usec))
 }
 
-func (c *SystemdController) FreezeUnit(ctx context.Context, name string) error {
+// ListUnits returns the status of all loaded whitelisted units in a single dbus call. Only the
+// fields provided by the unit listing are set, i.e., MainPID and FragmentPath are left empty.
+func (c *SystemdController) ListUnits(ctx context.Context) ([]UnitStatus, error) {
 
 	// Input validation
 	if ctx == nil {
-		return fmt.Errorf("context cannot be nil")
-	}
-	if name == "" {
-		return fmt.Errorf("incorrect input, must be unit name")
+		return nil, fmt.Errorf("context cannot be nil")
 	}
 
-	// Find unit(s)
-	units, err := c.FindUnit(name)
+	// List all units
+	units, err := c.dbusConn().ListUnitsContext(ctx)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("cannot list units: %v", err)
 	}
 
-	// Freeze unit(s)
-	for _, targetUnit := range units {
-		err := c.conn.FreezeUnit(ctx, targetUnit.Name)
-		if err != nil {
-			return err
+	// Filter whitelisted units
+	var statuses []UnitStatus
+	for _, unit := range units {
+		if c.canRead(unit.Name) && c.checkUnitType(unit.Name) == nil {
+			statuses = append(statuses, unitStatusFromListing(unit))
 		}
 	}
 
-	return nil
+	return statuses, nil
 }
 
-func (c *SystemdController) UnfreezeUnit(ctx context.Context, name string) error {
+// ListUnitsByState returns the status of all loaded whitelisted units whose ActiveState equals
+// state, e.g. 'failed' or 'activating'.
+func (c *SystemdController) ListUnitsByState(ctx context.Context, state string) ([]UnitStatus, error) {
 
 	// Input validation
 	if ctx == nil {
-		return fmt.Errorf("context cannot be nil")
+		return nil, fmt.Errorf("context cannot be nil")
 	}
-	if name == "" {
-		return fmt.Errorf("incorrect input, must be unit name")
+	if state == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit state")
 	}
 
-	// Find unit(s)
-	units, err := c.FindUnit(name)
+	// List units; systemd's state filter also matches load and sub states
+	units, err := c.dbusConn().ListUnitsFilteredContext(ctx, []string{state})
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("cannot list units: %v", err)
 	}
 
-	// Freeze unit(s)
-	for _, targetUnit := range units {
-		err := c.conn.ThawUnit(ctx, targetUnit.Name)
-		if err != nil {
-			return err
+	// Filter whitelisted units
+	var statuses []UnitStatus
+	for _, unit := range units {
+		if unit.ActiveState == state && c.canRead(unit.Name) && c.checkUnitType(unit.Name) == nil {
+			statuses = append(statuses, unitStatusFromListing(unit))
 		}
 	}
 
-	return nil
+	return statuses, nil
+}
+
+// ListFailedUnits returns the status of all whitelisted units in the 'failed' state.
+func (c *SystemdController) ListFailedUnits(ctx context.Context) ([]UnitStatus, error) {
+	return c.ListUnitsByState(ctx, "failed")
+}
+
+func unitStatusFromListing(unit dbus.UnitStatus) UnitStatus {
+	return UnitStatus{
+		Name:        unit.Name,
+		Description: unit.Description,
+		LoadState:   unit.LoadState,
+		ActiveState: unit.ActiveState,
+		SubState:    unit.SubState,
+	}
+}
+
+// unitStatusFromProperties extracts the UnitStatus fields from a dbus property map. Missing
+// or mistyped properties are left empty.
+func unitStatusFromProperties(name string, props map[string]interface{}) *UnitStatus {
+	status := &UnitStatus{
+		Name: name,
+	}
+	status.Description, _ = props["Description"].(string)
+	status.LoadState, _ = props["LoadState"].(string)
+	status.ActiveState, _ = props["ActiveState"].(string)
+	status.SubState, _ = props["SubState"].(string)
+	status.MainPID, _ = props["MainPID"].(uint32)
+	status.FragmentPath, _ = props["FragmentPath"].(string)
+	status.LoadError = loadErrorMessage(props["LoadError"])
+	return status
+}
+
+// loadErrorMessage returns the message of the LoadError property of type (ss), i.e., the dbus
+// error name and message, falling back to the name if there is no message.
+func loadErrorMessage(value interface{}) string {
+	loadError, _ := value.([]interface{})
+	if len(loadError) != 2 {
+		return ""
+	}
+	errName, _ := loadError[0].(string)
+	message, _ := loadError[1].(string)
+	if message == "" {
+		return errName
+	}
+	return message
 }
 
-func (c *SystemdController) GetUnitCpuAndMem(ctx context.Context, pid uint32) (float64, float32, error) {
+// ApplicationResult describes an application started with StartApplication.
+type ApplicationResult struct {
+	Unit      string
+	StartedAt time.Time
+	// Main process of the application; 0 if not available
+	PID uint32
+	// Equivalent systemd-run command, only set in dry-run mode
+	DryRunCommand string
+}
+
+// StartApplication runs the application as transient service on the controller's connection,
+// i.e., in the system manager when running as root and in the user manager otherwise. A service
+// name without instance, e.g. 'app@.service', is expanded with a unique instance. Arguments are
+// appended to the application's command, e.g. to open different URLs in separate instances.
+// If the unit is already running, ErrAlreadyRunning is returned with the result naming the unit.
+// With WithDryRun, nothing is started.
+func (c *SystemdController) StartApplication(ctx context.Context, serviceName string, args ...string) (_ *ApplicationResult, err error) {
+	defer c.beginOp(ctx, serviceName, "start-application")(&err)
+	defer c.trackOp()()
 
 	// Input validation
 	if ctx == nil {
-		return 0, 0, fmt.Errorf("context cannot be nil")
+		return nil, fmt.Errorf("context cannot be nil")
 	}
 
-	// Get process information for the service PID
-	p, err := process.NewProcess(int32(pid))
-	if err != nil {
-		fmt.Printf("Error getting process information for PID %d: %v\n", pid, err)
-		return 0, 0, err
+	// Verify input format
+	if !applicationServiceRegex.MatchString(serviceName) {
+		return nil, fmt.Errorf("incorrect application service name")
+	}
+
+	// Extract app name and expand instance
+	appName, instance, _ := strings.Cut(strings.TrimSuffix(serviceName, ".service"), "@")
+	if !isSafeName(appName) || (instance != "" && !isSafeName(instance)) {
+		return nil, fmt.Errorf("incorrect application service name")
+	}
+	spec, ok := c.applications[appName]
+	if !ok {
+		return nil, fmt.Errorf("application unknown")
+	}
+	if instance == "" {
+		instance, err = newInstanceName()
+		if err != nil {
+			return nil, err
+		}
+		serviceName = appName + "@" + instance + ".service"
+	}
+
+	// Assemble command; only the executable tokens are rewritten to absolute paths, so
+	// arguments equal to or containing the app name are left intact
+	appArgs := slices.Clone(spec.Exec)
+	for _, i := range executableIndexes(appArgs, appName) {
+		appArgs[i], err = c.resolveBinary(appArgs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Extra arguments are passed verbatim; systemd expands '$' in ExecStart, so escape it
+	for _, arg := range args {
+		if strings.ContainsRune(arg, 0) {
+			return nil, fmt.Errorf("incorrect input, argument contains NUL character")
+		}
+		appArgs = append(appArgs, strings.ReplaceAll(arg, "$", "$$"))
+	}
+
+	// Transient service properties
+	env := []string{"XDG_CONFIG_DIRS=" + xdgConfigDirs()}
+	var extraEnv []string
+	for key, value := range spec.Env {
+		extraEnv = append(extraEnv, key+"="+value)
+	}
+	slices.Sort(extraEnv)
+	env = append(env, extraEnv...)
+	props := []dbus.Property{
+		dbus.PropExecStart(appArgs, false),
+		dbus.PropType("exec"),
+		{
+			Name:  "Environment",
+			Value: dbus_direct.MakeVariant(env),
+		},
+	}
+	if spec.WorkingDir != "" {
+		props = append(props, dbus.Property{Name: "WorkingDirectory", Value: dbus_direct.MakeVariant(spec.WorkingDir)})
+	}
+	if c.dryRun {
+		cmd := c.systemdRunCommand(serviceName, appArgs, env, spec.WorkingDir)
+		c.unitLog(serviceName, "start-application").WithField("command", cmd).Info("dry run")
+		return &ApplicationResult{Unit: serviceName, DryRunCommand: cmd}, nil
+	}
+
+	// Check application is not running; transient units cannot be started twice
+	units, err := c.lookupUnit(serviceName)
+	if err != nil && !errors.Is(err, ErrUnitNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		switch units[0].ActiveState {
+		case "active", "activating", "reloading":
+			return &ApplicationResult{Unit: serviceName}, fmt.Errorf("%w: %s", ErrAlreadyRunning, serviceName)
+		}
 	}
 
-	// Get CPU usage percentage
-	cpuPercent, err := p.CPUPercent()
+	// Run command as transient service
+	ch := newJobChannel()
+	_, err = c.dbusConn().StartTransientUnitContext(ctx, serviceName, "replace", props, ch)
 	if err != nil {
-		fmt.Printf("Error getting CPU usage for PID %d: %v\n", pid, err)
-		return 0, 0, err
+		return nil, fmt.Errorf("error starting application: %s (%w)", strings.Join(appArgs, " "), unitOpError(serviceName, err))
 	}
 
-	// Get memory usage statistics
-	memInfo, err := p.MemoryPercent()
+	// Check command started
+	status, err := waitForJob(ctx, ch, "start", serviceName)
 	if err != nil {
-		fmt.Printf("Error getting memory usage for PID %d: %v\n", pid, err)
-		return 0, 0, err
+		return &ApplicationResult{Unit: serviceName}, err
+	}
+	c.unitLog(serviceName, "start-application").WithField("result", status).Info("command completed")
+
+	// Whitelist application service
+	c.mu.Lock()
+	c.appUnits[serviceName] = true
+	c.mu.Unlock()
+
+	// Main PID is known once the start job of the 'exec' service completed
+	result := &ApplicationResult{Unit: serviceName, StartedAt: time.Now()}
+	prop, err := c.dbusConn().GetServicePropertyContext(ctx, serviceName, "MainPID")
+	if err == nil {
+		result.PID, _ = prop.Value.Value().(uint32)
 	}
 
-	return cpuPercent, memInfo, nil
+	return result, nil
 }
 
-func (c *SystemdController) GetUnitProperties(ctx context.Context, unitName string) (map[string]interface{}, error) {
+// StopApplication stops an application started with StartApplication, clears its failed
+// state, and removes it from the whitelist.
+func (c *SystemdController) StopApplication(ctx context.Context, serviceName string) (err error) {
+	defer c.beginOp(ctx, serviceName, "stop-application")(&err)
+	defer c.trackOp()()
 
 	// Input validation
 	if ctx == nil {
-		return nil, fmt.Errorf("context cannot be nil")
+		return fmt.Errorf("context cannot be nil")
 	}
-	if unitName == "" {
-		return nil, fmt.Errorf("incorrect input, must be unit name")
+	if !applicationServiceRegex.MatchString(serviceName) || strings.Contains(serviceName, "@.") {
+		return fmt.Errorf("incorrect application service name")
 	}
 
-	// Get unit properties
-	props, err := c.conn.GetAllPropertiesContext(ctx, unitName)
-	if err != nil {
-		return nil, err
+	// Find unit; transient units are unloaded by systemd once they exited
+	units, err := c.findUnit(serviceName, lookupLive)
+	if err != nil && !errors.Is(err, ErrUnitNotFound) {
+		return err
 	}
 
-	return props, nil
-}
+	// Stop unit; transient units that already exited may be unloaded
+	for _, targetUnit := range units {
+		if targetUnit.LoadState == "loaded" && targetUnit.ActiveState != "inactive" {
+			_, err := c.StopUnit(ctx, targetUnit.Name)
+			if err != nil {
+				return err
+			}
+		}
+		err := c.dbusConn().ResetFailedUnitContext(ctx, targetUnit.Name)
+		if err != nil {
+			c.unitLog(targetUnit.Name, "stop-application").WithError(err).Info("cannot reset failed state")
+		}
+	}
 
-func (c *SystemdController) StartApplication(ctx context.Context, serviceName string) (string, error) {
+	// Remove application service from whitelist; entries of the static configuration are kept
+	c.mu.Lock()
+	delete(c.appUnits, serviceName)
+	c.mu.Unlock()
 
-	cmdFailure := "Command failed."
+	return nil
+}
 
-	// Verify input format
-	if !strings.Contains(serviceName, ".service") || !strings.Contains(serviceName, "@") {
-		return cmdFailure, fmt.Errorf("incorrect application service name")
+// systemdRunCommand returns the systemd-run invocation equivalent to the transient service, with
+// arguments quoted for a POSIX shell where needed.
+func (c *SystemdController) systemdRunCommand(serviceName string, appArgs []string, env []string, workingDir string) string {
+	cmd := []string{"systemd-run"}
+	if !c.systemMode {
+		cmd = append(cmd, "--user")
 	}
+	cmd = append(cmd, "--unit="+serviceName, "--property=Type=exec")
+	for _, e := range env {
+		cmd = append(cmd, "--setenv="+e)
+	}
+	if workingDir != "" {
+		cmd = append(cmd, "--working-directory="+workingDir)
+	}
+	cmd = append(cmd, "--")
+	cmd = append(cmd, appArgs...)
+	for i, arg := range cmd {
+		cmd[i] = shellQuote(arg)
+	}
+	return strings.Join(cmd, " ")
+}
 
-	// Extract app name
-	appName := strings.Split(serviceName, "@")[0]
-	appCmd, ok := c.applications[appName]
-	if !ok {
-		return cmdFailure, fmt.Errorf("application unknown")
+// shellQuote quotes the argument with single quotes unless it consists of characters a POSIX
+// shell does not interpret. Single quotes inside are closed, escaped, and reopened.
+func shellQuote(arg string) string {
+	safe := arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r))
+	}) < 0
+	if safe {
+		return arg
 	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// unitLog returns a logger with the unit and operation as structured fields.
+func (c *SystemdController) unitLog(name string, op string) *log.Entry {
+	return c.logger.WithFields(log.Fields{"unit": name, "op": op})
+}
 
-	// Assemble command
-	appCmd = strings.ReplaceAll(appCmd, "run-waypipe", "/run/current-system/sw/bin/run-waypipe")
-	appCmd = strings.ReplaceAll(appCmd, appName, "/run/current-system/sw/bin/"+appName)
+// newInstanceName returns a random instance name for application services.
+func newInstanceName() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate instance name: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
 
-	systemdRunCmd := "/run/current-system/sw/bin/systemd-run"
-	systemdRunCmd += " --user "
-	systemdRunCmd += " --property=Type=exec "
-	systemdRunCmd += " -E XDG_CONFIG_DIRS=$XDG_CONFIG_DIRS:/etc/xdg "
-	systemdRunCmd += " -u " + serviceName + " "
-	systemdRunCmd += appCmd
+// isSafeName reports whether name is a plain file name, i.e., cannot be used to escape a directory.
+func isSafeName(name string) bool {
+	return name != "" && name != "." && !strings.Contains(name, "..") && !strings.ContainsAny(name, "/\\\x00")
+}
 
-	// Run command
-	cmd := exec.Command("/bin/sh", "-c", systemdRunCmd)
-	err := cmd.Run()
+// resolveBinary returns the absolute path of the executable in the bin path, falling back to $PATH.
+func (c *SystemdController) resolveBinary(name string) (string, error) {
+	if !isSafeName(name) {
+		return "", fmt.Errorf("invalid executable name %q, must be a plain file name", name)
+	}
+	path := filepath.Join(c.binPath, name)
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return path, nil
+	}
+	path, err := exec.LookPath(name)
 	if err != nil {
-		return "", fmt.Errorf("error starting application: %s (%s)", systemdRunCmd, err)
+		return "", fmt.Errorf("cannot find executable %s in %s or $PATH", name, c.binPath)
 	}
+	return path, nil
+}
 
-	// Whitelist application service
-	c.whitelist = append(c.whitelist, serviceName)
-	// @TODO remove application from whitelist?
+// xdgConfigDirs appends /etc/xdg to the agent's XDG_CONFIG_DIRS. An unset variable must not
+// leave a leading colon, which some applications interpret as the current directory.
+func xdgConfigDirs() string {
+	dirs := os.Getenv("XDG_CONFIG_DIRS")
+	if dirs == "" {
+		return "/etc/xdg"
+	}
+	return dirs + ":/etc/xdg"
+}
 
-	// Inject executable
-	// var props []dbus.Property
+// executableIndexes returns the indexes of the application command to resolve in the bin path:
+// the executable if it is the app name or 'run-waypipe', and the app name wrapped by the latter.
+func executableIndexes(exec []string, appName string) []int {
+	if len(exec) < 1 {
+		return nil
+	}
+	switch exec[0] {
+	case appName:
+		return []int{0}
+	case "run-waypipe":
+		if len(exec) > 1 && exec[1] == appName {
+			return []int{0, 1}
+		}
+		return []int{0}
+	}
+	return nil
+}
 
-	// propExecStart := dbus.PropExecStart([]string{appCmd}, false)
-	// propType := dbus.PropType("exec")
-	// probEnvironment := dbus.Property{
-	// 	Name:  "Environment",
-	// 	Value: dbus_direct.MakeVariant("XDG_CONFIG_DIRS=$XDG_CONFIG_DIRS:/etc/xdg"),
-	// }
-	// props = append(props, propExecStart, propType, probEnvironment)
-	// props = append(props, propExecStart, propType)
+// splitCommand splits a command line into arguments like a POSIX shell would, honoring single
+// and double quotes and backslash escapes, but without any expansion.
+func splitCommand(cmd string) ([]string, error) {
+
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
 
-	// Run command as transient service
-	// ch := make(chan string)
-	// _, err := c.conn.StartTransientUnitContext(ctx, serviceName, "replace", props, ch)
-	// if err != nil {
-	// 	return cmdFailure, fmt.Errorf("error starting application: %s (%s)", appCmd, err)
-	// }
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in command")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) < 1 {
+		return nil, fmt.Errorf("empty command")
+	}
 
-	// Check command started
-	// status := <-ch
-	// switch status {
-	// case "done":
-	// 	log.Infof("application %s (re)start cmd successful\n", serviceName)
-	// default:
-	// 	return cmdFailure, fmt.Errorf("failed to start app %s: %s", serviceName, status)
-	// }
-
-	return "Command successful.", nil
+	return args, nil
 }
@@ -0,0 +1,448 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	dbus_direct "github.com/godbus/dbus/v5"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", cmd: "foot --title term", want: []string{"foot", "--title", "term"}},
+		{name: "extra whitespace", cmd: "  foot \t --title\nterm ", want: []string{"foot", "--title", "term"}},
+		{name: "single quotes", cmd: `app 'a b' '$HOME'`, want: []string{"app", "a b", "$HOME"}},
+		{name: "double quotes", cmd: `app "a 'b' c"`, want: []string{"app", "a 'b' c"}},
+		{name: "escapes", cmd: `app a\ b \"c\"`, want: []string{"app", "a b", `"c"`}},
+		{name: "empty argument", cmd: `app ''`, want: []string{"app", ""}},
+		{name: "app name inside arguments", cmd: "cat concat-logs --cat=cat", want: []string{"cat", "concat-logs", "--cat=cat"}},
+		{name: "empty", cmd: " ", wantErr: true},
+		{name: "unterminated quote", cmd: `app "a b`, wantErr: true},
+		{name: "trailing backslash", cmd: `app a\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitCommand(%q) error = %v, wantErr %v", tt.cmd, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecutableIndexes(t *testing.T) {
+	tests := []struct {
+		name    string
+		exec    []string
+		appName string
+		want    []int
+	}{
+		{name: "app", exec: []string{"chromium", "--incognito"}, appName: "chromium", want: []int{0}},
+		{name: "app name as argument", exec: []string{"cat", "cat", "concat-logs"}, appName: "cat", want: []int{0}},
+		{name: "app name inside executable", exec: []string{"concat-logs", "cat"}, appName: "cat", want: nil},
+		{name: "waypipe", exec: []string{"run-waypipe", "foot", "foot"}, appName: "foot", want: []int{0, 1}},
+		{name: "waypipe other executable", exec: []string{"run-waypipe", "ssh", "foot"}, appName: "foot", want: []int{0}},
+		{name: "absolute path", exec: []string{"/usr/bin/foot"}, appName: "foot", want: nil},
+		{name: "empty", exec: nil, appName: "foot", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := executableIndexes(tt.exec, tt.appName)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("executableIndexes(%q, %q) = %v, want %v", tt.exec, tt.appName, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConcurrentStartApplication runs StartApplication next to whitelist readers and reloads;
+// run with -race.
+func TestConcurrentStartApplication(t *testing.T) {
+	conn := newFakeConn("foo.service")
+	c := newTestController(t, conn, []string{"foo.service"},
+		WithBinPath(newTestBinPath(t, "app")),
+		WithApplicationSpecs(map[string]AppSpec{"app": {Exec: []string{"app"}}}),
+	)
+
+	const starts = 20
+	services := make(chan string, starts)
+	var wg sync.WaitGroup
+	for i := 0; i < starts; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			result, err := c.StartApplication(context.Background(), "app@.service")
+			if err != nil {
+				t.Errorf("StartApplication() error = %v", err)
+				return
+			}
+			services <- result.Unit
+		}()
+		go func() {
+			defer wg.Done()
+			c.IsUnitWhitelisted("app@0.service")
+			c.Whitelist()
+			err := c.ReloadWhitelist([]string{"foo.service"})
+			if err != nil {
+				t.Errorf("ReloadWhitelist() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(services)
+
+	for service := range services {
+		if !c.IsUnitWhitelisted(service) {
+			t.Errorf("started application %s is not whitelisted", service)
+		}
+	}
+	if !c.IsUnitWhitelisted("foo.service") {
+		t.Errorf("configured unit foo.service is not whitelisted")
+	}
+}
+
+// TestStartUnitCancel checks a start job that never completes returns once the context is cancelled.
+func TestStartUnitCancel(t *testing.T) {
+	conn := newFakeConn("foo.service")
+	conn.startUnit = func(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+		return 1, nil
+	}
+	c := newTestController(t, conn, []string{"foo.service"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := c.StartUnit(ctx, "foo.service")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("StartUnit() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("StartUnit() returned after %s, want prompt return on cancellation", elapsed)
+	}
+}
+
+func TestUsecTimestamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  time.Time
+	}{
+		{name: "timestamp", value: uint64(1700000000123456), want: time.UnixMicro(1700000000123456)},
+		{name: "epoch plus one", value: uint64(1), want: time.UnixMicro(1)},
+		{name: "never as zero", value: uint64(0), want: time.Time{}},
+		{name: "never as UINT64_MAX", value: uint64(math.MaxUint64), want: time.Time{}},
+		{name: "beyond int64", value: uint64(math.MaxInt64) + 1, want: time.Time{}},
+		{name: "wrong type", value: int64(1700000000123456), want: time.Time{}},
+		{name: "missing", value: nil, want: time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := usecTimestamp(tt.value)
+			if !got.Equal(tt.want) {
+				t.Errorf("usecTimestamp(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ControllerOption
+	}{
+		{name: "zero start timeout", opt: WithStartTimeout(0)},
+		{name: "negative start timeout", opt: WithStartTimeout(-time.Second)},
+		{name: "negative log stream buffer", opt: WithLogStreamBackpressure(-1, false)},
+		{name: "zero watch interval", opt: WithWatchInterval(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newControllerWithConn(newFakeConn("foo.service"), false, []string{"foo.service"}, nil, tt.opt)
+			if err == nil {
+				t.Errorf("newControllerWithConn() succeeded, want invalid configuration error")
+			}
+		})
+	}
+}
+
+// TestUnwhitelistedReads checks read-only lookups of units outside the whitelist are allowed
+// only with WithUnwhitelistedReads, and are not cached.
+func TestUnwhitelistedReads(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   bool
+		wantErr error
+	}{
+		{name: "allowed", allow: true},
+		{name: "not allowed", allow: false, wantErr: ErrNotWhitelisted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newFakeConn("foo.service", "bar.service")
+			c := newTestController(t, conn, []string{"foo.service"},
+				WithUnwhitelistedReads(tt.allow),
+				WithUnitCache(time.Minute),
+			)
+			_, err := c.ProbeUnit(context.Background(), "bar.service", nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProbeUnit() error = %v, want %v", err, tt.wantErr)
+			}
+			_, err = c.StopUnit(context.Background(), "bar.service")
+			if !errors.Is(err, ErrNotWhitelisted) {
+				t.Errorf("StopUnit() error = %v, want %v", err, ErrNotWhitelisted)
+			}
+			if _, ok := c.unitCache["bar.service"]; ok {
+				t.Errorf("lookup of unwhitelisted unit bar.service was cached")
+			}
+		})
+	}
+}
+
+// TestListUnitsAllowedTypes checks glob whitelist entries do not bypass WithAllowedUnitTypes.
+func TestListUnitsAllowedTypes(t *testing.T) {
+	conn := newFakeConn("foo.service", "foo.socket", "bar.service")
+	c := newTestController(t, conn, []string{"foo.service"}, WithAllowedUnitTypes(".service"))
+	// Validation rejects the glob, but the listings must not rely on that
+	c.whitelist = []string{"foo*"}
+
+	units, err := c.ListUnits(context.Background())
+	if err != nil {
+		t.Fatalf("ListUnits() error = %v", err)
+	}
+	var names []string
+	for _, unit := range units {
+		names = append(names, unit.Name)
+	}
+	want := []string{"foo.service"}
+	if !slices.Equal(names, want) {
+		t.Errorf("ListUnits() = %q, want %q", names, want)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{name: "plain", arg: "--unit=app@1.service", want: "--unit=app@1.service"},
+		{name: "path", arg: "/run/current-system/sw/bin/foot", want: "/run/current-system/sw/bin/foot"},
+		{name: "empty", arg: "", want: "''"},
+		{name: "space", arg: "a b", want: "'a b'"},
+		{name: "variable", arg: "--setenv=HOME=$HOME", want: "'--setenv=HOME=$HOME'"},
+		{name: "single quote", arg: "it's", want: `'it'\''s'`},
+		{name: "double quote and backslash", arg: `"a\b"`, want: `'"a\b"'`},
+		{name: "glob", arg: "*.txt", want: "'*.txt'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shellQuote(tt.arg)
+			if got != tt.want {
+				t.Errorf("shellQuote(%q) = %s, want %s", tt.arg, got, tt.want)
+			}
+			if split, err := splitCommand(got); err != nil || !slices.Equal(split, []string{tt.arg}) {
+				t.Errorf("splitCommand(%s) = %q, %v, want %q", got, split, err, tt.arg)
+			}
+		})
+	}
+}
+
+// TestWatchUnitClose checks the watch channel is closed when the controller is closed.
+func TestWatchUnitClose(t *testing.T) {
+	conn := newFakeConn("foo.service")
+	c := newTestController(t, conn, []string{"foo.service"}, WithWatchInterval(10*time.Millisecond))
+
+	changes, err := c.WatchUnit(context.Background(), "foo.service")
+	if err != nil {
+		t.Fatalf("WatchUnit() error = %v", err)
+	}
+	c.Close()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Errorf("WatchUnit() sent a change, want channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("WatchUnit() channel not closed after Close()")
+	}
+}
+
+func TestWaitInvalidTimeout(t *testing.T) {
+	c := newTestController(t, newFakeConn("foo.service"), []string{"foo.service"})
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		err := c.WaitForUnitState(context.Background(), "foo.service", "active", timeout)
+		if err == nil {
+			t.Errorf("WaitForUnitState() with timeout %s succeeded, want error", timeout)
+		}
+		err = c.WaitForUnitsActive(context.Background(), []string{"foo.service"}, timeout)
+		if err == nil {
+			t.Errorf("WaitForUnitsActive() with timeout %s succeeded, want error", timeout)
+		}
+	}
+}
+
+func TestStopOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		after map[string][]string
+		// before holds Before relationships, which order the listed units first
+		before map[string][]string
+		want   []string
+	}{
+		{name: "independent", names: []string{"c", "a", "b"}, want: []string{"c", "a", "b"}},
+		{name: "after", names: []string{"b", "a"}, after: map[string][]string{"a": {"b"}}, want: []string{"a", "b"}},
+		{name: "before", names: []string{"a", "b"}, before: map[string][]string{"a": {"b"}}, want: []string{"b", "a"}},
+		{name: "chain", names: []string{"c", "b", "a"}, after: map[string][]string{"a": {"b"}, "b": {"c"}}, want: []string{"a", "b", "c"}},
+		{name: "ties keep given order", names: []string{"a", "c", "b"}, after: map[string][]string{"b": {"a"}, "c": {"a"}}, want: []string{"c", "b", "a"}},
+		{name: "unknown units ignored", names: []string{"b", "a"}, after: map[string][]string{"a": {"x"}, "b": {"b"}}, want: []string{"b", "a"}},
+		{name: "cycle", names: []string{"a", "b", "c"}, after: map[string][]string{"a": {"b"}, "b": {"a"}}, want: []string{"c", "a", "b"}},
+		{
+			name:  "cycle with dependents",
+			names: []string{"a", "b", "c", "d"},
+			after: map[string][]string{"a": {"b"}, "b": {"a"}, "d": {"a"}},
+			want:  []string{"c", "d", "a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := make(map[string]*UnitDeps, len(tt.names))
+			for _, name := range tt.names {
+				deps[name] = &UnitDeps{After: tt.after[name], Before: tt.before[name]}
+			}
+			got := stopOrder(tt.names, deps)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stopOrder(%q) = %q, want %q", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGetUnitCpuAndMem samples a busy loop in the test process, and an exited process.
+func TestGetUnitCpuAndMem(t *testing.T) {
+	c := newTestController(t, newFakeConn("foo.service"), []string{"foo.service"})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+	stats, err := c.GetUnitCpuAndMem(context.Background(), uint32(os.Getpid()))
+	if err != nil {
+		t.Fatalf("GetUnitCpuAndMem() error = %v", err)
+	}
+	if !stats.Running || stats.CPUPercent <= 0 || stats.MemoryPercent <= 0 || stats.NumFDs <= 0 {
+		t.Errorf("GetUnitCpuAndMem() of busy process = %+v, want running with CPU, memory, and FDs", stats)
+	}
+
+	cmd := exec.Command("true")
+	err = cmd.Run()
+	if err != nil {
+		t.Skipf("cannot run true: %v", err)
+	}
+	stats, err = c.GetUnitCpuAndMem(context.Background(), uint32(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("GetUnitCpuAndMem() of exited process error = %v", err)
+	}
+	if stats.Running {
+		t.Errorf("GetUnitCpuAndMem() of exited process = %+v, want not running", stats)
+	}
+}
+
+func TestUnitOpError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "no such unit", err: &dbus_direct.Error{Name: "org.freedesktop.systemd1.NoSuchUnit"}, wantErr: ErrUnitNotFound},
+		{name: "unknown object", err: dbus_direct.Error{Name: "org.freedesktop.DBus.Error.UnknownObject"}, wantErr: ErrUnitNotFound},
+		{name: "access denied", err: &dbus_direct.Error{Name: "org.freedesktop.DBus.Error.AccessDenied"}, wantErr: ErrPermissionDenied},
+		{name: "authorization required", err: &dbus_direct.Error{Name: "org.freedesktop.DBus.Error.InteractiveAuthorizationRequired"}, wantErr: ErrPermissionDenied},
+		{name: "wrapped", err: fmt.Errorf("call failed: %w", &dbus_direct.Error{Name: "org.freedesktop.systemd1.NoSuchUnit"}), wantErr: ErrUnitNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := unitOpError("foo.service", tt.err)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("unitOpError() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	other := errors.New("other")
+	if err := unitOpError("foo.service", other); err != other {
+		t.Errorf("unitOpError() = %v, want unchanged %v", err, other)
+	}
+}
+
+// TestStartUnitErrors checks failed start jobs and refused start requests are reported as JobError
+// and the controller's sentinel errors.
+func TestStartUnitErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     string
+		err        error
+		wantResult string
+		wantErr    error
+	}{
+		{name: "failed job", result: "failed", wantResult: "failed"},
+		{name: "dependency job", result: "dependency", wantResult: "dependency"},
+		{name: "cancelled job", result: "canceled", wantResult: "canceled", wantErr: context.Canceled},
+		{name: "no such unit", err: &dbus_direct.Error{Name: "org.freedesktop.systemd1.NoSuchUnit"}, wantErr: ErrUnitNotFound},
+		{name: "access denied", err: &dbus_direct.Error{Name: "org.freedesktop.DBus.Error.AccessDenied"}, wantErr: ErrPermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newFakeConn("foo.service")
+			conn.startUnit = func(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+				if tt.err != nil {
+					return 0, tt.err
+				}
+				ch <- tt.result
+				return 1, nil
+			}
+			c := newTestController(t, conn, []string{"foo.service"})
+
+			_, err := c.StartUnit(context.Background(), "foo.service")
+			if err == nil {
+				t.Fatalf("StartUnit() succeeded, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("StartUnit() error = %v, want %v", err, tt.wantErr)
+			}
+			var jobErr *JobError
+			if errors.As(err, &jobErr) != (tt.wantResult != "") {
+				t.Fatalf("StartUnit() error = %v, want JobError %t", err, tt.wantResult != "")
+			}
+			if jobErr != nil && (jobErr.Result != tt.wantResult || jobErr.Unit != "foo.service" || jobErr.Operation != "start") {
+				t.Errorf("StartUnit() JobError = %+v, want result %s of start of foo.service", jobErr, tt.wantResult)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	MaxLogLines          = 1000
+	DefaultLogStreamSize = 64
+)
+
+// WithLogStreamBackpressure sets the channel buffer of StreamUnitLogs and whether entries are
+// dropped when the buffer is full, instead of blocking the journal reader until the consumer catches up.
+// The buffer size must not be negative.
+func WithLogStreamBackpressure(bufferSize int, dropWhenFull bool) ControllerOption {
+	return func(c *SystemdController) {
+		if bufferSize < 0 {
+			c.optionErrs = append(c.optionErrs, fmt.Errorf("log stream buffer size must not be negative, got %d", bufferSize))
+			return
+		}
+		c.logStreamSize = bufferSize
+		c.logStreamDrop = dropWhenFull
+	}
+}
+
+// LogEntry is a single journal record of a unit.
+type LogEntry struct {
+	Timestamp time.Time
+	Priority  int
+	Message   string
+}
+
+// journalRecord holds the journalctl JSON fields used for LogEntry. MESSAGE is a string, or
+// an array of bytes if it is not valid UTF-8.
+type journalRecord struct {
+	RealtimeTimestamp string          `json:"__REALTIME_TIMESTAMP"`
+	Priority          string          `json:"PRIORITY"`
+	Message           json.RawMessage `json:"MESSAGE"`
+}
+
+// GetUnitLogs returns the last lines of the unit's journal, capped to MaxLogLines.
+func (c *SystemdController) GetUnitLogs(ctx context.Context, name string, lines int) ([]LogEntry, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	if lines < 1 {
+		return nil, fmt.Errorf("incorrect input, must request at least one line")
+	}
+	if lines > MaxLogLines {
+		lines = MaxLogLines
+	}
+	err := c.checkLocalHost("read journal")
+	if err != nil {
+		return nil, err
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read journal
+	journalctl, err := c.resolveBinary("journalctl")
+	if err != nil {
+		return nil, err
+	}
+	args := c.journalArgs(units[0].Name, "--lines", strconv.Itoa(lines))
+	output, err := exec.CommandContext(ctx, journalctl, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read journal of unit %s: %v", name, err)
+	}
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		entry, err := parseJournalRecord(scanner.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read journal of unit %s: %v", name, err)
+	}
+
+	return entries, nil
+}
+
+// StreamUnitLogs follows the unit's journal and sends new entries until the context is cancelled,
+// after which the reader is stopped and the channel closed.
+func (c *SystemdController) StreamUnitLogs(ctx context.Context, name string) (<-chan LogEntry, error) {
+
+	// Input validation
+	if ctx == nil {
+		return nil, fmt.Errorf("context cannot be nil")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("incorrect input, must be unit name")
+	}
+	err := c.checkLocalHost("read journal")
+	if err != nil {
+		return nil, err
+	}
+
+	// Find unit
+	units, err := c.findUnit(name, lookupRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Follow journal; the process is killed once the context is done
+	journalctl, err := c.resolveBinary("journalctl")
+	if err != nil {
+		return nil, err
+	}
+	args := c.journalArgs(units[0].Name, "--follow", "--lines", "0")
+	cmd := exec.CommandContext(ctx, journalctl, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("cannot follow journal of unit %s: %v", name, err)
+	}
+
+	entries := make(chan LogEntry, c.logStreamSize)
+	go func() {
+		defer close(entries)
+		defer cmd.Wait()
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			entry, err := parseJournalRecord(scanner.Bytes())
+			if err != nil {
+				c.unitLog(name, "stream-logs").WithError(err).Info("skipping journal entry")
+				continue
+			}
+
+			if c.logStreamDrop {
+				select {
+				case entries <- *entry:
+				case <-ctx.Done():
+					return
+				default:
+				}
+				continue
+			}
+			select {
+			case entries <- *entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return entries, nil
+}
+
+// journalArgs returns the journalctl arguments to read the unit's journal as JSON from the
+// manager the controller is connected to.
+func (c *SystemdController) journalArgs(name string, extra ...string) []string {
+	args := []string{"--output", "json", "--no-pager"}
+	if !c.systemMode {
+		args = append(args, "--user")
+	}
+	args = append(args, "--unit", name)
+	return append(args, extra...)
+}
+
+func parseJournalRecord(line []byte) (*LogEntry, error) {
+
+	var record journalRecord
+	err := json.Unmarshal(line, &record)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse journal entry: %v", err)
+	}
+
+	entry := &LogEntry{}
+	usec, err := strconv.ParseInt(record.RealtimeTimestamp, 10, 64)
+	if err == nil {
+		entry.Timestamp = time.UnixMicro(usec)
+	}
+	entry.Priority, err = strconv.Atoi(record.Priority)
+	if err != nil {
+		entry.Priority = -1
+	}
+
+	var raw []byte
+	if json.Unmarshal(record.Message, &entry.Message) != nil && json.Unmarshal(record.Message, &raw) == nil {
+		entry.Message = string(raw)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,27 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"time"
+)
+
+// Metrics receives the outcome of every mutating controller operation, e.g. to export
+// counters and latency histograms. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveOp is called when operation op on unit name completed after dur; err is nil on success
+	ObserveOp(name string, op string, dur time.Duration, err error)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveOp(string, string, time.Duration, error) {}
+
+// WithMetrics sets the receiver of operation metrics. By default, metrics are discarded.
+func WithMetrics(metrics Metrics) ControllerOption {
+	return func(c *SystemdController) {
+		if metrics != nil {
+			c.metrics = metrics
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DefaultRetryBackoff is the backoff before the first retry if the policy does not set one.
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// transientDbusErrors are dbus errors returned while the bus or systemd is temporarily busy.
+var transientDbusErrors = []string{
+	"org.freedesktop.DBus.Error.NoReply",
+	"org.freedesktop.DBus.Error.Timeout",
+	"org.freedesktop.DBus.Error.TimedOut",
+	"org.freedesktop.DBus.Error.LimitsExceeded",
+	"org.freedesktop.DBus.Error.NoMemory",
+}
+
+// RetryPolicy retries failed job requests of start, stop, and restart operations with exponential
+// backoff, bounded by the context deadline.
+type RetryPolicy struct {
+	// Total number of attempts; values below 2 disable retries
+	MaxAttempts int
+	// Backoff before the first retry, doubled after every attempt up to MaxBackoff; defaults to
+	// DefaultRetryBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable decides whether an error is retried; nil retries transient dbus errors only
+	Retryable func(err error) bool
+}
+
+// WithRetryPolicy sets the retry policy for job requests. By default, requests are not retried.
+func WithRetryPolicy(policy RetryPolicy) ControllerOption {
+	return func(c *SystemdController) {
+		if policy.Backoff < 0 || policy.MaxBackoff < 0 {
+			c.optionErrs = append(c.optionErrs, fmt.Errorf("retry backoff cannot be negative, got %s and %s", policy.Backoff, policy.MaxBackoff))
+			return
+		}
+		if policy.Backoff == 0 {
+			policy.Backoff = DefaultRetryBackoff
+		}
+		c.retryPolicy = policy
+	}
+}
+
+func isTransientDbusError(err error) bool {
+	return slices.Contains(transientDbusErrors, dbusErrorName(err))
+}
+
+// withRetry runs fn until it succeeds, fails with a non-retryable error, the attempts are
+// exhausted, or the context is done. The last error of fn is returned.
+func (c *SystemdController) withRetry(ctx context.Context, fn func() error) error {
+
+	policy := c.retryPolicy
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = isTransientDbusError
+	}
+
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 TII (SSRC) and the Ghaf contributors
+// SPDX-License-Identifier: Apache-2.0
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dbus_direct "github.com/godbus/dbus/v5"
+)
+
+func TestWithRetry(t *testing.T) {
+	errTransient := &dbus_direct.Error{Name: "org.freedesktop.DBus.Error.NoReply"}
+	errPermanent := errors.New("permanent")
+
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		errs      []error
+		timeout   time.Duration
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "transient error retried",
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			errs:      []error{errTransient, errTransient, nil},
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts exhausted",
+			policy:    RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+			errs:      []error{errTransient, errTransient, nil},
+			wantErr:   errTransient,
+			wantCalls: 2,
+		},
+		{
+			name:      "non-transient error not retried",
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			errs:      []error{errPermanent, nil},
+			wantErr:   errPermanent,
+			wantCalls: 1,
+		},
+		{
+			name: "custom retryable",
+			policy: RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Retryable: func(err error) bool {
+				return errors.Is(err, errPermanent)
+			}},
+			errs:      []error{errPermanent, nil},
+			wantCalls: 2,
+		},
+		{
+			name:      "retries disabled",
+			policy:    RetryPolicy{},
+			errs:      []error{errTransient, nil},
+			wantErr:   errTransient,
+			wantCalls: 1,
+		},
+		{
+			name:      "context deadline",
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Hour},
+			errs:      []error{errTransient, nil},
+			timeout:   50 * time.Millisecond,
+			wantErr:   errTransient,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, newFakeConn("foo.service"), []string{"foo.service"}, WithRetryPolicy(tt.policy))
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			calls := 0
+			start := time.Now()
+			err := c.withRetry(ctx, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("withRetry() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("withRetry() called fn %d times, want %d", calls, tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("withRetry() returned after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	c := newTestController(t, newFakeConn("foo.service"), []string{"foo.service"}, WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	if c.retryPolicy.Backoff != DefaultRetryBackoff {
+		t.Errorf("retry backoff = %s, want %s", c.retryPolicy.Backoff, DefaultRetryBackoff)
+	}
+
+	_, err := newControllerWithConn(newFakeConn("foo.service"), false, []string{"foo.service"}, nil,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: -time.Second}))
+	if err == nil {
+		t.Errorf("newControllerWithConn() with negative backoff succeeded, want invalid configuration error")
+	}
+}
@@ -52,11 +52,11 @@ func (s *SystemdControlServer) Close() {
 }
 
 func (s *SystemdControlServer) GetUnitStatus(ctx context.Context, req *systemd_api.UnitRequest) (*systemd_api.UnitStatusResponse, error) {
-	log.Infof("Incoming request to fetch unit status: %v\n", req)
+	s.Controller.unitLog(req.UnitName, "status").Info("incoming request")
 
-	unitStatus, err := s.Controller.FindUnit(req.UnitName)
+	unitStatus, err := s.Controller.findUnit(req.UnitName, lookupState)
 	if err != nil {
-		log.Infof("[GetUnitStatus] Error finding unit: %v", err)
+		s.Controller.unitLog(req.UnitName, "status").WithError(err).Info("error finding unit")
 		return nil, errors.New("error fetching unit status")
 	}
 	if len(unitStatus) != 1 {
@@ -80,65 +80,65 @@ func (s *SystemdControlServer) GetUnitStatus(ctx context.Context, req *systemd_a
 }
 
 func (s *SystemdControlServer) StartUnit(ctx context.Context, req *systemd_api.UnitRequest) (*systemd_api.UnitResponse, error) {
-	log.Infof("Incoming request to (re)start %v\n", req)
+	s.Controller.unitLog(req.UnitName, "restart").Info("incoming request")
 
-	err := s.Controller.StartUnit(context.Background(), req.UnitName)
+	_, err := s.Controller.RestartUnit(context.Background(), req.UnitName)
 	if err != nil {
-		log.Infof("[StartUnit] Error starting unit: %v", err)
+		s.Controller.unitLog(req.UnitName, "restart").WithError(err).Info("error starting unit")
 		return nil, errors.New("unit not started")
 	}
 	return &systemd_api.UnitResponse{CmdStatus: "Command successful"}, nil
 }
 
 func (s *SystemdControlServer) StopUnit(ctx context.Context, req *systemd_api.UnitRequest) (*systemd_api.UnitResponse, error) {
-	log.Infof("Incoming request to stop %v\n", req)
+	s.Controller.unitLog(req.UnitName, "stop").Info("incoming request")
 
-	err := s.Controller.StopUnit(context.Background(), req.UnitName)
+	_, err := s.Controller.StopUnit(context.Background(), req.UnitName)
 	if err != nil {
-		log.Infof("[StopUnit] Error stopping unit: %v\n", err)
+		s.Controller.unitLog(req.UnitName, "stop").WithError(err).Info("error stopping unit")
 		return nil, errors.New("unit not stopped")
 	}
 	return &systemd_api.UnitResponse{CmdStatus: "Command successful"}, nil
 }
 
 func (s *SystemdControlServer) KillUnit(ctx context.Context, req *systemd_api.UnitRequest) (*systemd_api.UnitResponse, error) {
-	log.Infof("Incoming request to kill %v\n", req)
+	s.Controller.unitLog(req.UnitName, "kill").Info("incoming request")
 
 	err := s.Controller.KillUnit(context.Background(), req.UnitName)
 	if err != nil {
-		log.Infof("[StartUnit] Error starting unit: %v\n", err)
+		s.Controller.unitLog(req.UnitName, "kill").WithError(err).Info("error killing unit")
 		return nil, errors.New("unit not killed")
 	}
 	return &systemd_api.UnitResponse{CmdStatus: "Command successful"}, nil
 }
 
 func (s *SystemdControlServer) FreezeUnit(ctx context.Context, req *systemd_api.UnitRequest) (*systemd_api.UnitResponse, error) {
-	log.Infof("Incoming request to freeze %v", req)
+	s.Controller.unitLog(req.UnitName, "freeze").Info("incoming request")
 
 	err := s.Controller.FreezeUnit(context.Background(), req.UnitName)
 	if err != nil {
-		log.Infof("[StartUnit] Error freezing unit: %v\n", err)
+		s.Controller.unitLog(req.UnitName, "freeze").WithError(err).Info("error freezing unit")
 		return nil, errors.New("unit not frozen")
 	}
 	return &systemd_api.UnitResponse{CmdStatus: "Command successful"}, nil
 }
 
 func (s *SystemdControlServer) UnfreezeUnit(ctx context.Context, req *systemd_api.UnitRequest) (*systemd_api.UnitResponse, error) {
-	log.Infof("Incoming request to unfreeze %v\n", req)
+	s.Controller.unitLog(req.UnitName, "unfreeze").Info("incoming request")
 
 	err := s.Controller.UnfreezeUnit(context.Background(), req.UnitName)
 	if err != nil {
-		log.Infof("[StartUnit] Error un-freezing unit: %v\n", err)
+		s.Controller.unitLog(req.UnitName, "unfreeze").WithError(err).Info("error unfreezing unit")
 		return nil, errors.New("unit not unfrozen")
 	}
 	return &systemd_api.UnitResponse{CmdStatus: "Command successful"}, nil
 }
 
 func (s *SystemdControlServer) MonitorUnit(req *systemd_api.UnitResourceRequest, stream systemd_api.UnitControlService_MonitorUnitServer) error {
-	log.Infof("Incoming resource monitor request for %v\n", req)
+	s.Controller.unitLog(req.UnitName, "monitor").Info("incoming request")
 
 	// Find unit
-	units, err := s.Controller.FindUnit(req.UnitName)
+	units, err := s.Controller.findUnit(req.UnitName, lookupState)
 	if err != nil {
 		return err
 	}
@@ -151,27 +151,17 @@ func (s *SystemdControlServer) MonitorUnit(req *systemd_api.UnitResourceRequest,
 		return fmt.Errorf("unit %s is %s", unit.Name, unit.ActiveState)
 	}
 
-	// Get pid from unit property or pid
-	unitProps, err := s.Controller.GetUnitProperties(context.Background(), unit.Name)
-	if err != nil {
-		return err
-	}
-
-	pid, ok := unitProps["MainPID"].(uint32)
-	if !ok || pid == 0 {
-		return fmt.Errorf("failed to unwrap integer value from dbus.Variant")
-	}
-
 	// for i := 0; i < 50; i += 1 {
 	for {
-		cpuUsage, memoryUsage, err := s.Controller.GetUnitCpuAndMem(context.Background(), pid)
+		// Resolve the main PID on every sample, it changes when the unit restarts
+		stats, err := s.Controller.GetUnitCpuAndMemByName(context.Background(), unit.Name)
 		if err != nil {
-			log.Infof("[MonitorUnit] Error fetching unit properties: %v\n", err)
+			s.Controller.unitLog(req.UnitName, "monitor").WithError(err).Info("error fetching unit statistics")
 			return fmt.Errorf("cannot fetch unit properties")
 		}
 		resp := &systemd_api.UnitResourceResponse{
-			CpuUsage:    cpuUsage,
-			MemoryUsage: memoryUsage,
+			CpuUsage:    stats.CPUPercent,
+			MemoryUsage: stats.MemoryPercent,
 		}
 		if err := stream.Send(resp); err != nil {
 			return err
@@ -182,10 +172,15 @@ func (s *SystemdControlServer) MonitorUnit(req *systemd_api.UnitResourceRequest,
 }
 
 func (s *SystemdControlServer) StartApplication(ctx context.Context, req *systemd_api.UnitRequest) (*systemd_api.UnitResponse, error) {
-	log.Infof("Executing application start method.\n")
-	resp, err := s.Controller.StartApplication(ctx, req.UnitName)
+	s.Controller.unitLog(req.UnitName, "start-application").Info("incoming request")
+	result, err := s.Controller.StartApplication(ctx, req.UnitName)
 	if err != nil {
 		return nil, err
 	}
-	return &systemd_api.UnitResponse{CmdStatus: resp}, nil
+	// In dry-run mode, the systemd-run preview; otherwise the started unit, i.e., with the
+	// generated instance for names like 'app@.service'
+	if result.DryRunCommand != "" {
+		return &systemd_api.UnitResponse{CmdStatus: result.DryRunCommand}, nil
+	}
+	return &systemd_api.UnitResponse{CmdStatus: result.Unit}, nil
 }
@@ -5,11 +5,13 @@ package utility
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -113,6 +115,51 @@ func GetCGroupPathForProcess(pid uint32) (string, error) {
 	return "", fmt.Errorf("cgroup information not found for process %d", pid)
 }
 
+// GetCGroupProcs returns the PIDs of all processes in the cgroup and its child cgroups. The
+// path is relative to the cgroup root, as in a unit's ControlGroup property.
+func GetCGroupProcs(cgroupPath string) ([]uint32, error) {
+	cgroupsPath := "/sys/fs/cgroup"
+
+	// Find the hierarchy systemd manages: unified (v2), hybrid, or the named v1 hierarchy
+	var root string
+	if _, err := os.Stat(filepath.Join(cgroupsPath, "cgroup.controllers")); err == nil {
+		root = cgroupsPath
+	} else if _, err := os.Stat(filepath.Join(cgroupsPath, "unified", cgroupPath)); err == nil {
+		root = filepath.Join(cgroupsPath, "unified")
+	} else {
+		root = filepath.Join(cgroupsPath, "systemd")
+	}
+	cgroupDir := filepath.Join(root, filepath.Clean("/"+cgroupPath))
+
+	// Walk the cgroup and its children
+	var pids []uint32
+	err := filepath.WalkDir(cgroupDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != "cgroup.procs" {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Fields(string(content)) {
+			pid, err := strconv.ParseUint(line, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid pid %s in %s", line, path)
+			}
+			pids = append(pids, uint32(pid))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pids, nil
+}
+
 func GetInterfaceIpv4(ifname string) (string, error) {
 
 	ief, err := net.InterfaceByName(ifname)